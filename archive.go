@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
+)
+
+const (
+	// archiveMaxDays is the longest date range GetArchiveData.cgi accepts.
+	archiveMaxDays = 16
+
+	// archiveMaxChannels is the most channels requested at once. The
+	// datalogger caps the channels of a request without documenting the
+	// number, so channel sets are split into small groups; the full set of
+	// archive channels takes several requests per window.
+	archiveMaxChannels = 8
+)
+
+// ArchiveOptions selects the archive channels and series type to request.
+type ArchiveOptions struct {
+	// Channels to request, all channels when empty
+	Channels []string
+
+	// "Detail" for every logged sample or "DailySum" for daily totals,
+	// "Detail" when empty
+	SeriesType string
+}
+
+// seriesType returns the series type to request.
+func (o ArchiveOptions) seriesType() string {
+	if o.SeriesType == "" {
+		return "Detail"
+	}
+
+	return o.SeriesType
+}
+
+// measurement returns the measurement name for archive data from base.
+func (o ArchiveOptions) measurement(base string) string {
+	if o.seriesType() == "DailySum" {
+		return base + "_daily"
+	}
+
+	return base
+}
+
+// parseSeriesType validates an archive series type.
+func parseSeriesType(seriesType string) (string, error) {
+	switch seriesType {
+	case "Detail", "DailySum":
+		return seriesType, nil
+	default:
+		return "", fmt.Errorf("%w: %s", ErrUnknownSeriesType, seriesType)
+	}
+}
+
+// archiveWindow is an inclusive range of dates.
+type archiveWindow struct {
+	start time.Time
+	end   time.Time
+}
+
+// archiveWindows splits an inclusive date range into windows the API accepts.
+func archiveWindows(startDate time.Time, endDate time.Time) (windows []archiveWindow) {
+	start := time.Date(startDate.Year(), startDate.Month(), startDate.Day(), 0, 0, 0, 0, startDate.Location())
+	end := time.Date(endDate.Year(), endDate.Month(), endDate.Day(), 0, 0, 0, 0, endDate.Location())
+
+	for !start.After(end) {
+		windowEnd := start.AddDate(0, 0, archiveMaxDays-1)
+		if windowEnd.After(end) {
+			windowEnd = end
+		}
+
+		windows = append(windows, archiveWindow{start: start, end: windowEnd})
+
+		start = windowEnd.AddDate(0, 0, 1)
+	}
+
+	return windows
+}
+
+// channelGroups splits channels into groups the API accepts.
+func channelGroups(channels []string) (groups [][]string) {
+	for len(channels) > archiveMaxChannels {
+		groups = append(groups, channels[:archiveMaxChannels])
+		channels = channels[archiveMaxChannels:]
+	}
+
+	if len(channels) > 0 {
+		groups = append(groups, channels)
+	}
+
+	return groups
+}
+
+// archive requests archive data one window and channel group at a time,
+// and stitches the responses into points.
+func (c Client) archive(ctx context.Context, q url.Values, startDate time.Time, endDate time.Time, opts ArchiveOptions, measurement string) (points []*write.Point, err error) {
+	series := make(archiveSeries)
+
+	channels := opts.Channels
+	if len(channels) == 0 {
+		channels = archiveChannels
+	}
+
+	q.Set("SeriesType", opts.seriesType())
+	q.Set("HumanReadable", "False")
+
+	for _, window := range archiveWindows(startDate, endDate) {
+		q.Set("StartDate", window.start.Format("2006-01-02"))
+		q.Set("EndDate", window.end.Format("2006-01-02"))
+
+		for _, group := range channelGroups(channels) {
+			q["Channel"] = group
+
+			r, err := c.readArchive(ctx, q)
+			if err != nil {
+				return points, err
+			}
+
+			if err = series.add(r, c.units); err != nil {
+				return points, err
+			}
+		}
+	}
+
+	return series.points(opts.measurement(measurement)), nil
+}
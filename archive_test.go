@@ -0,0 +1,308 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func date(s string) time.Time {
+	t, err := time.Parse("2006-01-02 15:04", s)
+	if err != nil {
+		panic(err)
+	}
+
+	return t
+}
+
+func TestArchiveWindows(t *testing.T) {
+	tests := []struct {
+		name  string
+		start string
+		end   string
+		want  [][2]string
+	}{
+		{
+			name:  "single day",
+			start: "2021-01-01 00:00",
+			end:   "2021-01-01 00:00",
+			want:  [][2]string{{"2021-01-01", "2021-01-01"}},
+		},
+		{
+			name:  "times within the day are ignored",
+			start: "2021-01-01 23:00",
+			end:   "2021-01-02 01:00",
+			want:  [][2]string{{"2021-01-01", "2021-01-02"}},
+		},
+		{
+			name:  "exactly the limit",
+			start: "2021-01-01 00:00",
+			end:   "2021-01-16 00:00",
+			want:  [][2]string{{"2021-01-01", "2021-01-16"}},
+		},
+		{
+			name:  "one day over the limit",
+			start: "2021-01-01 00:00",
+			end:   "2021-01-17 00:00",
+			want: [][2]string{
+				{"2021-01-01", "2021-01-16"},
+				{"2021-01-17", "2021-01-17"},
+			},
+		},
+		{
+			name:  "across a month",
+			start: "2021-01-20 12:00",
+			end:   "2021-02-20 12:00",
+			want: [][2]string{
+				{"2021-01-20", "2021-02-04"},
+				{"2021-02-05", "2021-02-20"},
+			},
+		},
+		{
+			name:  "start after end",
+			start: "2021-01-02 00:00",
+			end:   "2021-01-01 00:00",
+			want:  nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			windows := archiveWindows(date(tt.start), date(tt.end))
+
+			if len(windows) != len(tt.want) {
+				t.Fatalf("got %d windows, want %d: %v", len(windows), len(tt.want), windows)
+			}
+
+			for i, w := range windows {
+				got := [2]string{w.start.Format("2006-01-02"), w.end.Format("2006-01-02")}
+				if got != tt.want[i] {
+					t.Errorf("window %d: got %v, want %v", i, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestArchiveSeriesAdd(t *testing.T) {
+	tests := []struct {
+		name      string
+		responses []string
+		want      map[string]map[string]float64
+	}{
+		{
+			name: "single response",
+			responses: []string{
+				`{"inverter/1": {"Start": "2021-12-19T00:00:00+13:00", "Data": {"EnergyReal_WAC_Sum_Produced": {"Unit": "Wh", "Values": {"0": 10, "300": 12}}}}}`,
+			},
+			want: map[string]map[string]float64{
+				"2021-12-18T11:00:00Z": {"energy_real_wac_sum_produced": 10},
+				"2021-12-18T11:05:00Z": {"energy_real_wac_sum_produced": 12},
+			},
+		},
+		{
+			name: "overlapping windows in other time zones",
+			responses: []string{
+				`{"inverter/1": {"Start": "2021-12-19T00:00:00+13:00", "Data": {"EnergyReal_WAC_Sum_Produced": {"Unit": "Wh", "Values": {"0": 10, "300": 12}}}}}`,
+				`{"inverter/1": {"Start": "2021-12-18T11:00:00Z", "Data": {"EnergyReal_WAC_Sum_Produced": {"Unit": "Wh", "Values": {"300": 12, "600": 14}}}}}`,
+			},
+			want: map[string]map[string]float64{
+				"2021-12-18T11:00:00Z": {"energy_real_wac_sum_produced": 10},
+				"2021-12-18T11:05:00Z": {"energy_real_wac_sum_produced": 12},
+				"2021-12-18T11:10:00Z": {"energy_real_wac_sum_produced": 14},
+			},
+		},
+		{
+			name: "channels of one timestamp are merged",
+			responses: []string{
+				`{"inverter/1": {"Start": "2021-12-18T11:00:00Z", "Data": {"EnergyReal_WAC_Sum_Produced": {"Unit": "Wh", "Values": {"0": 10}}}}}`,
+				`{"inverter/1": {"Start": "2021-12-18T11:00:00Z", "Data": {"TimeSpanInSec": {"Unit": "sec", "Values": {"0": 300}}}}}`,
+			},
+			want: map[string]map[string]float64{
+				"2021-12-18T11:00:00Z": {"energy_real_wac_sum_produced": 10, "time_span": 300},
+			},
+		},
+		{
+			name: "null values are skipped",
+			responses: []string{
+				`{"inverter/1": {"Start": "2021-12-18T11:00:00Z", "Data": {"EnergyReal_WAC_Sum_Produced": {"Unit": "Wh", "Values": {"0": null, "300": 12}}}}}`,
+			},
+			want: map[string]map[string]float64{
+				"2021-12-18T11:05:00Z": {"energy_real_wac_sum_produced": 12},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			series := make(archiveSeries)
+
+			for _, body := range tt.responses {
+				var r archiveResponse
+
+				if err := json.Unmarshal([]byte(body), &r.Body.Data); err != nil {
+					t.Fatal(err)
+				}
+
+				if err := series.add(r, unitSystem{}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if len(series) != 1 {
+				t.Fatalf("got %d devices, want 1", len(series))
+			}
+
+			for _, values := range series {
+				if len(values) != len(tt.want) {
+					t.Fatalf("got %d timestamps, want %d: %v", len(values), len(tt.want), values)
+				}
+
+				for timestamp, fields := range values {
+					want, ok := tt.want[timestamp.Format(time.RFC3339)]
+					if !ok {
+						t.Errorf("unexpected timestamp %v", timestamp)
+
+						continue
+					}
+
+					if len(fields) != len(want) {
+						t.Errorf("%v: got fields %v, want %v", timestamp, fields, want)
+					}
+
+					for key, value := range want {
+						if fields[key] != value {
+							t.Errorf("%v: got %s=%v, want %v", timestamp, key, fields[key], value)
+						}
+					}
+				}
+			}
+		})
+	}
+}
+
+func channelNames(n int) (channels []string) {
+	for i := 0; i < n; i++ {
+		channels = append(channels, fmt.Sprintf("Channel_%d", i))
+	}
+
+	return channels
+}
+
+func TestChannelGroups(t *testing.T) {
+	tests := []struct {
+		name     string
+		channels int
+		want     []int
+	}{
+		{name: "none", channels: 0, want: []int{}},
+		{name: "one", channels: 1, want: []int{1}},
+		{name: "exactly the limit", channels: archiveMaxChannels, want: []int{archiveMaxChannels}},
+		{name: "one over the limit", channels: archiveMaxChannels + 1, want: []int{archiveMaxChannels, 1}},
+		{name: "twice the limit", channels: 2 * archiveMaxChannels, want: []int{archiveMaxChannels, archiveMaxChannels}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			channels := channelNames(tt.channels)
+			groups := channelGroups(channels)
+
+			if len(groups) != len(tt.want) {
+				t.Fatalf("got %d groups, want %d: %v", len(groups), len(tt.want), groups)
+			}
+
+			var seen []string
+
+			for i, group := range groups {
+				if len(group) != tt.want[i] {
+					t.Errorf("group %d: got %d channels, want %d", i, len(group), tt.want[i])
+				}
+
+				seen = append(seen, group...)
+			}
+
+			if strings.Join(seen, ",") != strings.Join(channels, ",") {
+				t.Errorf("groups %v do not cover %v in order", groups, channels)
+			}
+		})
+	}
+}
+
+func TestArchiveSplitsRequests(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		requests []url.Values
+	)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+
+		mu.Lock()
+		requests = append(requests, q)
+		mu.Unlock()
+
+		data := map[string]interface{}{}
+		for _, channel := range q["Channel"] {
+			data[channel] = map[string]interface{}{"Unit": "", "Values": map[string]float64{"0": 1}}
+		}
+
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"Body": map[string]interface{}{
+				"Data": map[string]interface{}{
+					"inverter/1": map[string]interface{}{
+						"Start": q.Get("StartDate") + "T00:00:00Z",
+						"Data":  data,
+					},
+				},
+			},
+			"head": map[string]interface{}{"Status": map[string]interface{}{"Code": 0}},
+		})
+	}))
+	defer srv.Close()
+
+	c := NewClient(strings.TrimPrefix(srv.URL, "http://"))
+
+	_, err := c.InverterArchive(context.Background(), "1", date("2021-01-01 00:00"), date("2021-01-30 00:00"), ArchiveOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	groups := len(channelGroups(archiveChannels))
+	if groups < 2 {
+		t.Fatalf("all archive channels fit in one request, the split is not exercised")
+	}
+
+	if len(requests) != 2*groups {
+		t.Fatalf("got %d requests, want %d", len(requests), 2*groups)
+	}
+
+	requested := map[string]map[string]bool{}
+
+	for _, q := range requests {
+		if n := len(q["Channel"]); n > archiveMaxChannels {
+			t.Errorf("request with %d channels", n)
+		}
+
+		window := q.Get("StartDate") + "/" + q.Get("EndDate")
+		if requested[window] == nil {
+			requested[window] = map[string]bool{}
+		}
+
+		for _, channel := range q["Channel"] {
+			requested[window][channel] = true
+		}
+	}
+
+	for _, window := range []string{"2021-01-01/2021-01-16", "2021-01-17/2021-01-30"} {
+		if len(requested[window]) != len(archiveChannels) {
+			t.Errorf("window %s: got %d channels, want %d", window, len(requested[window]), len(archiveChannels))
+		}
+	}
+}
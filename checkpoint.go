@@ -0,0 +1,243 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
+)
+
+// lockTimeout is how long to wait for another run to release the state file.
+const lockTimeout = time.Minute
+
+// ErrLocked is when the state file is locked by another run.
+var ErrLocked = errors.New("state file is locked")
+
+// errLockHeld is returned by tryLock when the lock file is locked.
+var errLockHeld = errors.New("lock held")
+
+// locks are the open lock files of this process, by locked path.
+var (
+	locksMu sync.Mutex
+	locks   = make(map[string]*os.File)
+)
+
+// checkpoint records the newest archive timestamp written per series and channel,
+// so later runs only fetch and emit newer samples. A series is a measurement,
+// the requested device ID and the device ID in the response, as archive
+// responses name devices differently from requests, e.g. meters by serial.
+type checkpoint struct {
+	path    string
+	overlap time.Duration
+
+	// last is the state loaded at the start of the run, next is the state to save
+	last map[string]map[string]time.Time
+	next map[string]map[string]time.Time
+}
+
+// openCheckpoint locks and loads the state file at path.
+// The lock is held until close is called.
+func openCheckpoint(path string, overlap time.Duration) (cp *checkpoint, err error) {
+	if err = lock(path); err != nil {
+		return nil, err
+	}
+
+	cp = &checkpoint{
+		path:    path,
+		overlap: overlap,
+		last:    make(map[string]map[string]time.Time),
+		next:    make(map[string]map[string]time.Time),
+	}
+
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cp, nil
+	}
+
+	if err == nil {
+		err = json.Unmarshal(b, &cp.last)
+	}
+
+	if err != nil {
+		_ = unlock(path)
+
+		return nil, err
+	}
+
+	for series, channels := range cp.last {
+		cp.next[series] = make(map[string]time.Time)
+
+		for channel, t := range channels {
+			cp.next[series][channel] = t
+		}
+	}
+
+	return cp, nil
+}
+
+// start returns the date to fetch measurement of the requested device id from,
+// or def when nothing has been recorded for that device.
+func (cp *checkpoint) start(measurement string, id string, def time.Time) time.Time {
+	if cp == nil {
+		return def
+	}
+
+	var earliest time.Time
+
+	for series, channels := range cp.last {
+		if !strings.HasPrefix(series, measurement+"/"+id+"/") {
+			continue
+		}
+
+		for _, t := range channels {
+			if earliest.IsZero() || t.Before(earliest) {
+				earliest = t
+			}
+		}
+	}
+
+	if earliest.IsZero() {
+		return def
+	}
+
+	return earliest.Add(-cp.overlap).Local()
+}
+
+// filter drops samples of the requested device id that are older than the recorded
+// timestamp minus the overlap, and records the newest timestamp of each remaining channel.
+func (cp *checkpoint) filter(points []*write.Point, id string) (filtered []*write.Point) {
+	if cp == nil {
+		return points
+	}
+
+	for _, p := range points {
+		tags := make(map[string]string)
+
+		for _, t := range p.TagList() {
+			tags[t.Key] = t.Value
+		}
+
+		series := p.Name() + "/" + id + "/" + tags["device_id"]
+
+		if _, ok := cp.next[series]; !ok {
+			cp.next[series] = make(map[string]time.Time)
+		}
+
+		values := make(map[string]interface{})
+
+		for _, f := range p.FieldList() {
+			if last, ok := cp.last[series][f.Key]; ok && !p.Time().After(last.Add(-cp.overlap)) {
+				continue
+			}
+
+			values[f.Key] = f.Value
+
+			if p.Time().After(cp.next[series][f.Key]) {
+				cp.next[series][f.Key] = p.Time()
+			}
+		}
+
+		if len(values) == 0 {
+			continue
+		}
+
+		filtered = append(filtered, influxdb2.NewPoint(p.Name(), tags, values, p.Time()))
+	}
+
+	return filtered
+}
+
+// save writes the recorded timestamps to the state file.
+func (cp *checkpoint) save() error {
+	b, err := json.MarshalIndent(cp.next, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(cp.path), filepath.Base(cp.path)+".*")
+	if err != nil {
+		return err
+	}
+
+	if _, err = tmp.Write(b); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+
+		return err
+	}
+
+	if err = tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+
+		return err
+	}
+
+	return os.Rename(tmp.Name(), cp.path)
+}
+
+// close releases the state file lock.
+func (cp *checkpoint) close() error {
+	return unlock(cp.path)
+}
+
+// lock locks a lock file next to path, waiting for other runs to release it.
+// The lock is held by the operating system rather than by the file existing,
+// so a run that is killed does not leave it behind. The PID of the holder is
+// written to the file for information only.
+func lock(path string) error {
+	lockPath := path + ".lock"
+	deadline := time.Now().Add(lockTimeout)
+
+	for {
+		f, err := tryLock(lockPath)
+		if err == nil {
+			if err = f.Truncate(0); err == nil {
+				_, err = fmt.Fprintf(f, "%d\n", os.Getpid())
+			}
+
+			if err != nil {
+				_ = f.Close()
+
+				return err
+			}
+
+			locksMu.Lock()
+			locks[path] = f
+			locksMu.Unlock()
+
+			return nil
+		}
+
+		if !errors.Is(err, errLockHeld) {
+			return err
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%w: %s", ErrLocked, lockPath)
+		}
+
+		time.Sleep(time.Second)
+	}
+}
+
+// unlock releases the lock taken by lock. The lock file is kept, as removing
+// it could let a run waiting on the old file and a new run both lock.
+func unlock(path string) error {
+	locksMu.Lock()
+	f, ok := locks[path]
+	delete(locks, path)
+	locksMu.Unlock()
+
+	if !ok {
+		return nil
+	}
+
+	return f.Close()
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
+)
+
+func archivePoint(deviceID string, t string, fields map[string]interface{}) *write.Point {
+	return influxdb2.NewPoint("inverter_archive", map[string]string{"device_id": deviceID}, fields, date(t))
+}
+
+func TestCheckpointRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	def := date("2021-01-01 00:00")
+
+	cp, err := openCheckpoint(path, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := cp.start("inverter_archive", "1", def); !got.Equal(def) {
+		t.Errorf("empty checkpoint: got start %v, want %v", got, def)
+	}
+
+	points := cp.filter([]*write.Point{
+		archivePoint("1", "2021-01-05 10:00", map[string]interface{}{"energy": 1.0, "time_span": 300.0}),
+		archivePoint("1", "2021-01-05 12:00", map[string]interface{}{"energy": 2.0}),
+		archivePoint("2", "2021-01-04 08:00", map[string]interface{}{"energy": 3.0}),
+	}, "1")
+
+	if len(points) != 3 {
+		t.Fatalf("empty checkpoint: got %d points, want 3", len(points))
+	}
+
+	if err = cp.save(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = cp.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	cp, err = openCheckpoint(path, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer cp.close()
+
+	// the earliest channel of any device in the responses for device 1, less
+	// the overlap
+	if got, want := cp.start("inverter_archive", "1", def), date("2021-01-04 07:00"); !got.Equal(want) {
+		t.Errorf("got start %v, want %v", got, want)
+	}
+
+	if got := cp.start("inverter_archive", "2", def); !got.Equal(def) {
+		t.Errorf("unrecorded device: got start %v, want %v", got, def)
+	}
+
+	if got := cp.start("meter_archive", "1", def); !got.Equal(def) {
+		t.Errorf("unrecorded measurement: got start %v, want %v", got, def)
+	}
+}
+
+func TestCheckpointFilter(t *testing.T) {
+	tests := []struct {
+		name   string
+		id     string
+		point  *write.Point
+		fields []string
+	}{
+		{
+			name:   "older than the overlap",
+			id:     "1",
+			point:  archivePoint("1", "2021-01-05 10:30", map[string]interface{}{"energy": 1.0}),
+			fields: nil,
+		},
+		{
+			name:   "at the start of the overlap",
+			id:     "1",
+			point:  archivePoint("1", "2021-01-05 11:00", map[string]interface{}{"energy": 1.0}),
+			fields: nil,
+		},
+		{
+			name:   "within the overlap",
+			id:     "1",
+			point:  archivePoint("1", "2021-01-05 11:30", map[string]interface{}{"energy": 1.0}),
+			fields: []string{"energy"},
+		},
+		{
+			name:   "newer",
+			id:     "1",
+			point:  archivePoint("1", "2021-01-05 13:00", map[string]interface{}{"energy": 1.0}),
+			fields: []string{"energy"},
+		},
+		{
+			name:   "channels are filtered separately",
+			id:     "1",
+			point:  archivePoint("1", "2021-01-05 10:30", map[string]interface{}{"energy": 1.0, "voltage_dc": 400.0}),
+			fields: []string{"voltage_dc"},
+		},
+		{
+			name:   "another response device",
+			id:     "1",
+			point:  archivePoint("2", "2021-01-05 10:30", map[string]interface{}{"energy": 1.0}),
+			fields: []string{"energy"},
+		},
+		{
+			name:   "another requested device",
+			id:     "3",
+			point:  archivePoint("1", "2021-01-05 10:30", map[string]interface{}{"energy": 1.0}),
+			fields: []string{"energy"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cp := &checkpoint{
+				overlap: time.Hour,
+				last: map[string]map[string]time.Time{
+					"inverter_archive/1/1": {"energy": date("2021-01-05 12:00")},
+				},
+				next: make(map[string]map[string]time.Time),
+			}
+
+			points := cp.filter([]*write.Point{tt.point}, tt.id)
+
+			if len(tt.fields) == 0 {
+				if len(points) != 0 {
+					t.Errorf("got %d points, want none", len(points))
+				}
+
+				return
+			}
+
+			if len(points) != 1 {
+				t.Fatalf("got %d points, want 1", len(points))
+			}
+
+			fields := points[0].FieldList()
+			if len(fields) != len(tt.fields) {
+				t.Fatalf("got %d fields, want %v", len(fields), tt.fields)
+			}
+
+			for i, f := range fields {
+				if f.Key != tt.fields[i] {
+					t.Errorf("field %d: got %s, want %s", i, f.Key, tt.fields[i])
+				}
+			}
+		})
+	}
+}
+
+func TestCheckpointKeepsNewest(t *testing.T) {
+	cp := &checkpoint{
+		overlap: time.Hour,
+		last: map[string]map[string]time.Time{
+			"inverter_archive/1/1": {"energy": date("2021-01-05 12:00")},
+		},
+		next: map[string]map[string]time.Time{
+			"inverter_archive/1/1": {"energy": date("2021-01-05 12:00")},
+		},
+	}
+
+	// samples re-read within the overlap must not move the checkpoint back
+	cp.filter([]*write.Point{archivePoint("1", "2021-01-05 11:30", map[string]interface{}{"energy": 1.0})}, "1")
+
+	if got, want := cp.next["inverter_archive/1/1"]["energy"], date("2021-01-05 12:00"); !got.Equal(want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+
+	// a lock file left by a run that was killed does not block the next run
+	if err := os.WriteFile(path+".lock", []byte("12345\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := lock(path); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := tryLock(path + ".lock"); !errors.Is(err, errLockHeld) {
+		t.Errorf("got %v while locked, want %v", err, errLockHeld)
+	}
+
+	if err := unlock(path); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := tryLock(path + ".lock")
+	if err != nil {
+		t.Fatalf("got %v after unlock", err)
+	}
+
+	_ = f.Close()
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
 
@@ -14,6 +15,7 @@ import (
 type Client struct {
 	host   string
 	client *http.Client
+	units  unitSystem
 }
 
 // NewClient creates a Fronius HTTP client.
@@ -21,15 +23,18 @@ func NewClient(host string) Client {
 	return Client{
 		host:   host,
 		client: &http.Client{},
+		units:  unitSystem{},
 	}
 }
 
-func (c Client) readArchive(ctx context.Context, q url.Values) (result archiveResponse, err error) {
-	u := url.URL{Scheme: "http", Host: c.host, Path: "/solar_api/v1/GetArchiveData.cgi", RawQuery: q.Encode()}
+// get requests a Solar API endpoint and decodes the response into v.
+// A non-zero status code in the response head is returned as an *APIError.
+func (c Client) get(ctx context.Context, path string, q url.Values, v interface{}) (err error) {
+	u := url.URL{Scheme: "http", Host: c.host, Path: path, RawQuery: q.Encode()}
 
 	res, err := ctxhttp.Get(ctx, c.client, u.String())
 	if err != nil {
-		return result, err
+		return err
 	}
 
 	defer func() {
@@ -39,13 +44,32 @@ func (c Client) readArchive(ctx context.Context, q url.Values) (result archiveRe
 	}()
 
 	if res.StatusCode != http.StatusOK {
-		return result, fmt.Errorf("%w: %d", ErrStatusNotOk, res.StatusCode)
+		return fmt.Errorf("%w: %d", ErrStatusNotOk, res.StatusCode)
+	}
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+
+	var h struct {
+		Head head `json:"head"`
 	}
 
-	err = json.NewDecoder(res.Body).Decode(&result)
+	err = json.Unmarshal(body, &h)
 	if err != nil {
-		return result, err
+		return err
 	}
 
+	if sErr := h.Head.err(); sErr != nil {
+		return fmt.Errorf("%s: %w", path, sErr)
+	}
+
+	return json.Unmarshal(body, v)
+}
+
+func (c Client) readArchive(ctx context.Context, q url.Values) (result archiveResponse, err error) {
+	err = c.get(ctx, "/solar_api/v1/GetArchiveData.cgi", q, &result)
+
 	return result, err
 }
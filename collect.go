@@ -0,0 +1,274 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
+)
+
+// selection is the set of devices and data collections to gather.
+type selection struct {
+	inverters []string
+	meters    []string
+	sensors   []string
+	strings   []string
+
+	archive ArchiveOptions
+
+	storage    bool
+	ohmPilot   bool
+	system     bool
+	logger     bool
+	leds       bool
+	threePhase bool
+	cumulation bool
+}
+
+// resolveIDs parses a comma separated list of device IDs.
+// The value "all" is replaced with the active devices of deviceClass, or
+// with none when the datalogger does not support the device class.
+func resolveIDs(ctx context.Context, c Client, deviceClass string, list string) (ids []string, err error) {
+	seen := make(map[string]bool)
+
+	for _, id := range strings.Split(list, ",") {
+		id = strings.TrimSpace(id)
+
+		if id == "" || seen[id] {
+			continue
+		}
+
+		if id == "all" {
+			devices, err := c.ActiveDevices(ctx, deviceClass)
+			if unsupported(err) {
+				continue
+			}
+
+			if err != nil {
+				return ids, err
+			}
+
+			for _, d := range devices {
+				if !seen[d.ID] {
+					seen[d.ID] = true
+					ids = append(ids, d.ID)
+				}
+			}
+
+			continue
+		}
+
+		seen[id] = true
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
+
+// discovered replaces the device IDs in s with the discovered devices.
+func (s selection) discovered(devices []Device) selection {
+	s.inverters = nil
+	s.meters = nil
+	s.sensors = nil
+	s.strings = nil
+	s.storage = false
+	s.ohmPilot = false
+
+	for _, d := range devices {
+		switch d.Class {
+		case "Inverter":
+			s.inverters = append(s.inverters, d.ID)
+		case "Meter":
+			s.meters = append(s.meters, d.ID)
+		case "SensorCard":
+			s.sensors = append(s.sensors, d.ID)
+		case "StringControl":
+			s.strings = append(s.strings, d.ID)
+		case "Storage":
+			s.storage = true
+		case "Ohmpilot":
+			s.ohmPilot = true
+		}
+	}
+
+	return s
+}
+
+// collector gathers the points of one data collection.
+type collector struct {
+	name    string
+	collect func(ctx context.Context) ([]*write.Point, error)
+
+	// done, when set, is called once the points have been handed to the output.
+	done func(written bool) error
+}
+
+// each returns a collector that calls fn for every device ID.
+func each(name string, ids []string, fn func(ctx context.Context, id string) ([]*write.Point, error)) collector {
+	return collector{
+		name: name,
+		collect: func(ctx context.Context) (points []*write.Point, err error) {
+			for _, id := range ids {
+				p, err := fn(ctx, id)
+				if err != nil {
+					return points, err
+				}
+
+				points = append(points, p...)
+			}
+
+			return points, nil
+		},
+	}
+}
+
+// realtimeCollectors returns a collector per selected realtime data collection.
+func realtimeCollectors(c Client, s selection) (collectors []collector) {
+	if len(s.inverters) > 0 {
+		collectors = append(collectors, each("inverter", s.inverters, func(ctx context.Context, id string) (points []*write.Point, err error) {
+			points, err = c.InverterRealtime(ctx, id)
+			if err != nil {
+				return points, err
+			}
+
+			if s.threePhase {
+				p, err := c.InverterThreePhase(ctx, id)
+				if err != nil {
+					return points, err
+				}
+
+				points = append(points, p...)
+			}
+
+			if s.cumulation {
+				p, err := c.InverterCumulation(ctx, id)
+				if err != nil {
+					return points, err
+				}
+
+				points = append(points, p...)
+			}
+
+			return points, nil
+		}))
+	}
+
+	if len(s.meters) > 0 {
+		collectors = append(collectors, each("meter", s.meters, c.MeterRealtime))
+	}
+
+	if len(s.sensors) > 0 {
+		collectors = append(collectors, each("sensor", s.sensors, c.SensorRealtime))
+	}
+
+	if len(s.strings) > 0 {
+		collectors = append(collectors, each("strings", s.strings, c.StringRealtime))
+	}
+
+	if s.system {
+		collectors = append(collectors, collector{name: "powerflow", collect: c.PowerFlowRealtime})
+	}
+
+	if s.logger {
+		collectors = append(collectors, collector{name: "logger", collect: c.LoggerInfo})
+	}
+
+	if s.leds {
+		collectors = append(collectors, collector{name: "leds", collect: c.LoggerLEDInfo})
+	}
+
+	if s.storage {
+		collectors = append(collectors, collector{name: "storage", collect: c.StorageRealtime})
+	}
+
+	if s.ohmPilot {
+		collectors = append(collectors, collector{name: "ohmpilot", collect: c.OhmPilotRealtime})
+	}
+
+	return collectors
+}
+
+// minMaxCollector returns a collector for the minimum and maximum data of the selected devices.
+func minMaxCollector(c Client, s selection) collector {
+	inverters := each("minmax", s.inverters, c.InverterMinMax)
+	sensors := each("minmax", s.sensors, c.SensorMinMax)
+
+	return collector{
+		name: "minmax",
+		collect: func(ctx context.Context) (points []*write.Point, err error) {
+			points, err = inverters.collect(ctx)
+			if err != nil {
+				return points, err
+			}
+
+			p, err := sensors.collect(ctx)
+
+			return append(points, p...), err
+		},
+	}
+}
+
+// collectAll runs collectors one after another and merges their points.
+func collectAll(ctx context.Context, collectors []collector) (points []*write.Point, err error) {
+	for _, col := range collectors {
+		p, err := col.collect(ctx)
+		if err != nil {
+			return points, err
+		}
+
+		points = append(points, p...)
+	}
+
+	return points, nil
+}
+
+// collectRealtime returns realtime points for every selected device.
+func collectRealtime(ctx context.Context, c Client, s selection) (points []*write.Point, err error) {
+	return collectAll(ctx, realtimeCollectors(c, s))
+}
+
+// collectArchive returns archive and min/max points for every selected device.
+// When cp is not nil only samples newer than its checkpoints are returned.
+func collectArchive(ctx context.Context, c Client, s selection, startDate time.Time, endDate time.Time, cp *checkpoint) (points []*write.Point, err error) {
+	points, err = collectArchiveData(ctx, c, s, startDate, endDate, cp)
+	if err != nil {
+		return points, err
+	}
+
+	p, err := minMaxCollector(c, s).collect(ctx)
+
+	return append(points, p...), err
+}
+
+// collectArchiveData returns archive points for every selected device.
+func collectArchiveData(ctx context.Context, c Client, s selection, startDate time.Time, endDate time.Time, cp *checkpoint) (points []*write.Point, err error) {
+	for _, id := range s.inverters {
+		p, err := c.InverterArchive(ctx, id, cp.start(s.archive.measurement("inverter_archive"), id, startDate), endDate, s.archive)
+		if err != nil {
+			return points, err
+		}
+
+		points = append(points, cp.filter(p, id)...)
+	}
+
+	for _, id := range s.meters {
+		p, err := c.MeterArchive(ctx, id, cp.start(s.archive.measurement("meter_archive"), id, startDate), endDate, s.archive)
+		if err != nil {
+			return points, err
+		}
+
+		points = append(points, cp.filter(p, id)...)
+	}
+
+	if s.system {
+		p, err := c.SystemArchive(ctx, cp.start(s.archive.measurement("system_archive"), "system", startDate), endDate, s.archive)
+		if err != nil {
+			return points, err
+		}
+
+		points = append(points, cp.filter(p, "system")...)
+	}
+
+	return points, nil
+}
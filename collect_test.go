@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestResolveIDs(t *testing.T) {
+	// GetActiveDeviceInfo.cgi responses by device class
+	responses := map[string]string{
+		"Inverter":      `{"Body": {"Data": {"1": {"DT": 123}, "2": {"DT": 123}}}, "head": {"Status": {"Code": 0}}}`,
+		"SensorCard":    `{"Body": {"Data": {}}, "head": {"Status": {"Code": 11, "Reason": "NotSupported"}}}`,
+		"StringControl": `{"Body": {"Data": {}}, "head": {"Status": {"Code": 1, "Reason": "NotImplemented"}}}`,
+		"Meter":         `{"Body": {"Data": {}}, "head": {"Status": {"Code": 255, "Reason": "UnknownError"}}}`,
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, responses[r.URL.Query().Get("DeviceClass")])
+	}))
+	defer srv.Close()
+
+	c := NewClient(strings.TrimPrefix(srv.URL, "http://"))
+
+	tests := []struct {
+		name        string
+		deviceClass string
+		list        string
+		want        []string
+		err         bool
+	}{
+		{name: "list", deviceClass: "Inverter", list: "3, 1,,3", want: []string{"3", "1"}},
+		{name: "all", deviceClass: "Inverter", list: "all", want: []string{"1", "2"}},
+		{name: "all and a listed device", deviceClass: "Inverter", list: "2,all", want: []string{"2", "1"}},
+		{name: "all of an unsupported class", deviceClass: "SensorCard", list: "all", want: nil},
+		{name: "all of an unimplemented class", deviceClass: "StringControl", list: "all", want: nil},
+		{name: "listed device of an unsupported class", deviceClass: "SensorCard", list: "1,all", want: []string{"1"}},
+		{name: "other errors", deviceClass: "Meter", list: "all", err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ids, err := resolveIDs(context.Background(), c, tt.deviceClass, tt.list)
+
+			var apiErr *APIError
+			if tt.err != errors.As(err, &apiErr) {
+				t.Fatalf("got error %v", err)
+			}
+
+			if tt.err {
+				return
+			}
+
+			if strings.Join(ids, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("got %v, want %v", ids, tt.want)
+			}
+		})
+	}
+}
@@ -2,8 +2,9 @@ package main
 
 import (
 	"errors"
-	"net/url"
+	"fmt"
 	"strconv"
+	"strings"
 	"time"
 
 	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
@@ -76,50 +77,226 @@ type timeValues map[time.Time]map[string]interface{}
 // ErrStatusNotOk is when the HTTP response code is not 200.
 var ErrStatusNotOk = errors.New("status not OK")
 
-func defaultValues() url.Values {
-	q := url.Values{}
-
-	q.Add("Channel", "TimeSpanInSec")
-	q.Add("Channel", "EnergyReal_WAC_Sum_Produced")
-	q.Add("Channel", "EnergyReal_WAC_Sum_Consumed")
-	q.Add("Channel", "Current_DC_String_1")
-	q.Add("Channel", "Current_DC_String_2")
-	q.Add("Channel", "Voltage_DC_String_1")
-	q.Add("Channel", "Voltage_DC_String_2")
-	q.Add("Channel", "Temperature_Powerstage")
-	q.Add("Channel", "Voltage_AC_Phase_1")
-	q.Add("Channel", "Voltage_AC_Phase_2")
-	q.Add("Channel", "Voltage_AC_Phase_3")
-	q.Add("Channel", "Current_AC_Phase_1")
-	q.Add("Channel", "Current_AC_Phase_2")
-	q.Add("Channel", "Current_AC_Phase_3")
-	q.Add("Channel", "PowerReal_PAC_Sum")
-	q.Add("Channel", "EnergyReal_WAC_Minus_Absolute")
-	q.Add("Channel", "EnergyReal_WAC_Plus_Absolute")
-	q.Add("Channel", "Meter_Location_Current")
-	q.Add("Channel", "Temperature_Channel_1")
-	q.Add("Channel", "Temperature_Channel_2")
-	q.Add("Channel", "Digital_Channel_1")
-	q.Add("Channel", "Digital_Channel_2")
-	q.Add("Channel", "Radiation")
-	q.Add("Channel", "Digital_PowerManagementRelay_Out_1")
-	q.Add("Channel", "Digital_PowerManagementRelay_Out_2")
-	q.Add("Channel", "Digital_PowerManagementRelay_Out_3")
-	q.Add("Channel", "Digital_PowerManagementRelay_Out_4")
-	q.Add("Channel", "Hybrid_Operating_State")
-
-	return q
-}
-
-func generateArchivePoints(r archiveResponse, measurement string) (points []*write.Point, err error) {
+// ErrUnknownChannel is when an archive channel or preset is not known.
+var ErrUnknownChannel = errors.New("unknown archive channel")
+
+// ErrUnknownSeriesType is when an archive series type is not supported.
+var ErrUnknownSeriesType = errors.New("unknown archive series type")
+
+// ErrInvalidInterval is when a collector interval cannot be parsed.
+var ErrInvalidInterval = errors.New("invalid collector interval")
+
+// ErrUnknownUnit is when a unit is not known.
+var ErrUnknownUnit = errors.New("unknown unit")
+
+// ErrUnexpectedUnit is when a value is reported in a unit of another quantity.
+var ErrUnexpectedUnit = errors.New("unexpected unit")
+
+// ErrUnknownNaming is when a naming scheme is not supported.
+var ErrUnknownNaming = errors.New("unknown naming scheme")
+
+// ErrUnsupportedPrefix is when a naming scheme does not allow a measurement prefix.
+var ErrUnsupportedPrefix = errors.New("unsupported prefix")
+
+// ErrUnknownFormat is when an output format is not supported.
+var ErrUnknownFormat = errors.New("unknown format")
+
+// ErrNoCollectors is when a long-running mode has nothing to collect.
+var ErrNoCollectors = errors.New("no collectors selected, use -realtime or -archive")
+
+// statusReasons are the documented Solar API status code names.
+var statusReasons = map[int]string{
+	0:   "OKAY",
+	1:   "NotImplemented",
+	2:   "Uninitialized",
+	3:   "Initialized",
+	4:   "Running",
+	5:   "Timeout",
+	6:   "ArgumentError",
+	7:   "LNRequestError",
+	8:   "LNRequestTimeout",
+	9:   "LNParseError",
+	10:  "ConfigIOError",
+	11:  "NotSupported",
+	12:  "DeviceNotAvailable",
+	255: "UnknownError",
+}
+
+// APIError is a non-zero status code returned in a Solar API response head.
+type APIError struct {
+	Code        int
+	Reason      string
+	UserMessage string
+}
+
+func (e *APIError) Error() string {
+	name, ok := statusReasons[e.Code]
+	if !ok {
+		name = "Unknown"
+	}
+
+	msg := fmt.Sprintf("solar api status %d (%s)", e.Code, name)
+
+	if e.Reason != "" {
+		msg += ": " + e.Reason
+	}
+
+	if e.UserMessage != "" && e.UserMessage != e.Reason {
+		msg += ": " + e.UserMessage
+	}
+
+	return msg
+}
+
+// err returns an *APIError when the head reports a non-zero status code.
+func (h head) err() error {
+	if h.Status.Code == 0 {
+		return nil
+	}
+
+	return &APIError{
+		Code:        h.Status.Code,
+		Reason:      h.Status.Reason,
+		UserMessage: h.Status.UserMessage,
+	}
+}
+
+// archiveChannels are the channels decoded from archive responses.
+var archiveChannels = []string{
+	"TimeSpanInSec",
+	"EnergyReal_WAC_Sum_Produced",
+	"EnergyReal_WAC_Sum_Consumed",
+	"Current_DC_String_1",
+	"Current_DC_String_2",
+	"Voltage_DC_String_1",
+	"Voltage_DC_String_2",
+	"Temperature_Powerstage",
+	"Voltage_AC_Phase_1",
+	"Voltage_AC_Phase_2",
+	"Voltage_AC_Phase_3",
+	"Current_AC_Phase_1",
+	"Current_AC_Phase_2",
+	"Current_AC_Phase_3",
+	"PowerReal_PAC_Sum",
+	"EnergyReal_WAC_Minus_Absolute",
+	"EnergyReal_WAC_Plus_Absolute",
+	"Meter_Location_Current",
+	"Temperature_Channel_1",
+	"Temperature_Channel_2",
+	"Digital_Channel_1",
+	"Digital_Channel_2",
+	"Radiation",
+	"Digital_PowerManagementRelay_Out_1",
+	"Digital_PowerManagementRelay_Out_2",
+	"Digital_PowerManagementRelay_Out_3",
+	"Digital_PowerManagementRelay_Out_4",
+	"Hybrid_Operating_State",
+}
+
+// archivePresets are named sets of archive channels.
+var archivePresets = map[string][]string{
+	"all": archiveChannels,
+	"energy": {
+		"TimeSpanInSec",
+		"EnergyReal_WAC_Sum_Produced",
+		"EnergyReal_WAC_Sum_Consumed",
+		"EnergyReal_WAC_Minus_Absolute",
+		"EnergyReal_WAC_Plus_Absolute",
+	},
+	"electrical": {
+		"Current_DC_String_1",
+		"Current_DC_String_2",
+		"Voltage_DC_String_1",
+		"Voltage_DC_String_2",
+		"Voltage_AC_Phase_1",
+		"Voltage_AC_Phase_2",
+		"Voltage_AC_Phase_3",
+		"Current_AC_Phase_1",
+		"Current_AC_Phase_2",
+		"Current_AC_Phase_3",
+		"PowerReal_PAC_Sum",
+	},
+	"sensors": {
+		"Temperature_Channel_1",
+		"Temperature_Channel_2",
+		"Digital_Channel_1",
+		"Digital_Channel_2",
+		"Radiation",
+	},
+	"relays": {
+		"Digital_PowerManagementRelay_Out_1",
+		"Digital_PowerManagementRelay_Out_2",
+		"Digital_PowerManagementRelay_Out_3",
+		"Digital_PowerManagementRelay_Out_4",
+	},
+	"status": {
+		"Temperature_Powerstage",
+		"Meter_Location_Current",
+		"Hybrid_Operating_State",
+	},
+}
+
+// parseChannels resolves a comma separated list of presets and channel names.
+func parseChannels(list string) (channels []string, err error) {
+	known := make(map[string]bool)
+
+	for _, channel := range archiveChannels {
+		known[channel] = true
+	}
+
+	seen := make(map[string]bool)
+
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+
+		if name == "" {
+			continue
+		}
+
+		preset, ok := archivePresets[name]
+		if !ok {
+			if !known[name] {
+				return channels, fmt.Errorf("%w: %s", ErrUnknownChannel, name)
+			}
+
+			preset = []string{name}
+		}
+
+		for _, channel := range preset {
+			if !seen[channel] {
+				seen[channel] = true
+				channels = append(channels, channel)
+			}
+		}
+	}
+
+	return channels, nil
+}
+
+// archiveDevice identifies a device in an archive response.
+type archiveDevice struct {
+	ID         string
+	DeviceType int
+	NodeType   int
+}
+
+// archiveSeries collects archive values per device, keyed by timestamp.
+type archiveSeries map[archiveDevice]timeValues
+
+// add merges the values of an archive response, converted to units, into
+// the series. Values for a timestamp that is already present are merged into it.
+func (s archiveSeries) add(r archiveResponse, units unitSystem) (err error) {
 	for deviceID, deviceData := range r.Body.Data {
-		tags := map[string]string{
-			"device_id":   deviceID,
-			"device_type": strconv.Itoa(deviceData.DeviceType),
-			"node_type":   strconv.Itoa(deviceData.NodeType),
+		device := archiveDevice{
+			ID:         deviceID,
+			DeviceType: deviceData.DeviceType,
+			NodeType:   deviceData.NodeType,
 		}
 
-		timeValues := make(timeValues)
+		values, ok := s[device]
+		if !ok {
+			values = make(timeValues)
+		}
 
 		assignments := map[string]*archiveData{
 			"time_span":                            &deviceData.Data.TimeSpan,
@@ -153,11 +330,26 @@ func generateArchivePoints(r archiveResponse, measurement string) (points []*wri
 		}
 
 		for key, archiveData := range assignments {
-			if timeValues, err = ingest(timeValues, deviceData.Start, archiveData, key); err != nil {
-				return points, err
+			if values, err = ingest(values, deviceData.Start, archiveData, key, units); err != nil {
+				return err
 			}
 		}
 
+		s[device] = values
+	}
+
+	return nil
+}
+
+// points returns a point per device and timestamp.
+func (s archiveSeries) points(measurement string) (points []*write.Point) {
+	for device, timeValues := range s {
+		tags := map[string]string{
+			"device_id":   device.ID,
+			"device_type": strconv.Itoa(device.DeviceType),
+			"node_type":   strconv.Itoa(device.NodeType),
+		}
+
 		for timestamp, values := range timeValues {
 			point := influxdb2.NewPoint(measurement, tags, values, timestamp)
 
@@ -165,10 +357,29 @@ func generateArchivePoints(r archiveResponse, measurement string) (points []*wri
 		}
 	}
 
-	return points, nil
+	return points
 }
 
-func ingest(timeValues timeValues, startTime time.Time, archiveData *archiveData, key string) (timeValues, error) {
+// addTags copies the non-empty values into tags; line protocol does not
+// allow a tag without a value.
+func addTags(tags map[string]string, optional map[string]string) {
+	for key, value := range optional {
+		if value != "" {
+			tags[key] = value
+		}
+	}
+}
+
+// addOptional copies the non-nil values into values.
+func addOptional(values map[string]interface{}, optional map[string]*float64) {
+	for key, value := range optional {
+		if value != nil {
+			values[key] = *value
+		}
+	}
+}
+
+func ingest(timeValues timeValues, startTime time.Time, archiveData *archiveData, key string, units unitSystem) (timeValues, error) {
 	for offsetStr, value := range archiveData.Values {
 		offset, err := strconv.Atoi(offsetStr)
 		if err != nil {
@@ -176,14 +387,20 @@ func ingest(timeValues timeValues, startTime time.Time, archiveData *archiveData
 		}
 
 		if value != nil {
-			timestamp := startTime.Add(time.Duration(offset) * time.Second)
+			v, err := units.convert(key, *value, archiveData.Unit)
+			if err != nil {
+				return timeValues, err
+			}
+
+			// normalise the location so overlapping responses share map keys
+			timestamp := startTime.Add(time.Duration(offset) * time.Second).UTC()
 
 			_, ok := timeValues[timestamp]
 			if !ok {
 				timeValues[timestamp] = make(map[string]interface{})
 			}
 
-			timeValues[timestamp][key] = *value
+			timeValues[timestamp][key] = v
 		}
 	}
 
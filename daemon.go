@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
+)
+
+// defaultInterval is the daemon interval of collectors without their own.
+const defaultInterval = time.Minute
+
+// collectorNames are the collectors that can be given an interval.
+var collectorNames = map[string]bool{
+	"inverter":  true,
+	"meter":     true,
+	"sensor":    true,
+	"strings":   true,
+	"powerflow": true,
+	"logger":    true,
+	"leds":      true,
+	"storage":   true,
+	"ohmpilot":  true,
+	"minmax":    true,
+	"archive":   true,
+}
+
+// parseIntervals parses a comma separated list of collector=duration pairs.
+func parseIntervals(list string) (intervals map[string]time.Duration, err error) {
+	intervals = make(map[string]time.Duration)
+
+	for _, pair := range strings.Split(list, ",") {
+		pair = strings.TrimSpace(pair)
+
+		if pair == "" {
+			continue
+		}
+
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || !collectorNames[parts[0]] {
+			return intervals, fmt.Errorf("%w: %s", ErrInvalidInterval, pair)
+		}
+
+		d, err := time.ParseDuration(parts[1])
+		if err != nil || d <= 0 {
+			return intervals, fmt.Errorf("%w: %s", ErrInvalidInterval, pair)
+		}
+
+		intervals[parts[0]] = d
+	}
+
+	return intervals, nil
+}
+
+// archiveCollector returns a collector for the last days of archive data.
+// With a state path the checkpoint is locked while collecting and saved once
+// the points have been written.
+func archiveCollector(c Client, s selection, days uint, statePath string, overlap time.Duration) collector {
+	var cp *checkpoint
+
+	return collector{
+		name: "archive",
+		collect: func(ctx context.Context) (points []*write.Point, err error) {
+			startDate := time.Now().AddDate(0, 0, 0-int(days))
+			endDate := time.Now()
+
+			if statePath != "" {
+				cp, err = openCheckpoint(statePath, overlap)
+				if err != nil {
+					return points, err
+				}
+			}
+
+			return collectArchiveData(ctx, c, s, startDate, endDate, cp)
+		},
+		done: func(written bool) (err error) {
+			if cp == nil {
+				return nil
+			}
+
+			if written {
+				err = cp.save()
+			}
+
+			if cErr := cp.close(); err == nil {
+				err = cErr
+			}
+
+			cp = nil
+
+			return err
+		},
+	}
+}
+
+// runDaemon runs each collector on its own interval and writes the points
+// to out until ctx is cancelled. Errors are logged and collection continues.
+func runDaemon(ctx context.Context, collectors []collector, intervals map[string]time.Duration, fallback time.Duration, out output) {
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+
+	for _, col := range collectors {
+		interval, ok := intervals[col.name]
+		if !ok {
+			interval = fallback
+		}
+
+		wg.Add(1)
+
+		go func(col collector, interval time.Duration) {
+			defer wg.Done()
+
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+
+			for {
+				points, err := col.collect(ctx)
+				if err != nil && ctx.Err() == nil {
+					log.Printf("%s: %v", col.name, err)
+				}
+
+				written := err == nil
+
+				if len(points) > 0 {
+					mu.Lock()
+					err = out.write(ctx, points)
+					mu.Unlock()
+
+					if err != nil {
+						log.Printf("%s: %v", col.name, err)
+
+						written = false
+					}
+				}
+
+				if col.done != nil {
+					if err = col.done(written); err != nil {
+						log.Printf("%s: %v", col.name, err)
+					}
+				}
+
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+				}
+			}
+		}(col, interval)
+	}
+
+	wg.Wait()
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+)
+
+// deviceClasses are the device classes queried during discovery.
+var deviceClasses = []string{"Inverter", "Meter", "Storage", "Ohmpilot", "SensorCard", "StringControl"}
+
+// Device is an active device reported by the datalogger.
+type Device struct {
+	Class  string `json:"class"`
+	ID     string `json:"id"`
+	Type   int    `json:"device_type"`
+	Serial string `json:"serial,omitempty"`
+}
+
+type activeDeviceInfoResponse struct {
+	Body struct {
+		Data map[string]struct {
+			// device type, -1 when not applicable
+			DeviceType int    `json:"DT"`
+			Serial     string `json:"Serial"`
+		} `json:"Data"`
+	} `json:"Body"`
+	Head head `json:"head"`
+}
+
+// ActiveDevices returns the active devices of a device class.
+func (c Client) ActiveDevices(ctx context.Context, deviceClass string) (devices []Device, err error) {
+	var r activeDeviceInfoResponse
+
+	q := url.Values{}
+
+	q.Set("DeviceClass", deviceClass)
+
+	err = c.get(ctx, "/solar_api/v1/GetActiveDeviceInfo.cgi", q, &r)
+	if err != nil {
+		return devices, err
+	}
+
+	for deviceID, deviceData := range r.Body.Data {
+		devices = append(devices, Device{
+			Class:  deviceClass,
+			ID:     deviceID,
+			Type:   deviceData.DeviceType,
+			Serial: deviceData.Serial,
+		})
+	}
+
+	sort.Slice(devices, func(i, j int) bool {
+		return lessID(devices[i].ID, devices[j].ID)
+	})
+
+	return devices, nil
+}
+
+// unsupported reports whether err is the datalogger not supporting a
+// request, such as a device class it has no devices of.
+func unsupported(err error) bool {
+	var apiErr *APIError
+
+	return errors.As(err, &apiErr) && (apiErr.Code == 1 || apiErr.Code == 11)
+}
+
+// Discover returns the active devices of every device class.
+// Device classes the datalogger does not support are skipped.
+func (c Client) Discover(ctx context.Context) (devices []Device, err error) {
+	for _, deviceClass := range deviceClasses {
+		found, err := c.ActiveDevices(ctx, deviceClass)
+
+		if unsupported(err) {
+			continue
+		}
+
+		if err != nil {
+			return devices, err
+		}
+
+		devices = append(devices, found...)
+	}
+
+	return devices, nil
+}
+
+// lessID orders device IDs numerically where possible.
+func lessID(a, b string) bool {
+	ai, aErr := strconv.Atoi(a)
+	bi, bErr := strconv.Atoi(b)
+
+	if aErr == nil && bErr == nil {
+		return ai < bi
+	}
+
+	return a < b
+}
+
+// printDevices writes the device inventory as a table or as JSON.
+func printDevices(w io.Writer, devices []Device, format string) error {
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+
+		if devices == nil {
+			devices = []Device{}
+		}
+
+		return enc.Encode(devices)
+	case "table":
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+		fmt.Fprintln(tw, "CLASS\tID\tTYPE\tSERIAL")
+
+		for _, d := range devices {
+			fmt.Fprintf(tw, "%s\t%s\t%d\t%s\n", d.Class, d.ID, d.Type, d.Serial)
+		}
+
+		return tw.Flush()
+	default:
+		return fmt.Errorf("%w: %s", ErrUnknownFormat, format)
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"log"
+
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
+)
+
+// runExecd runs the collectors and writes their points to out each time a
+// line is read from r, as signalled by the Telegraf execd input. It returns
+// when r is closed or ctx is cancelled. Errors are logged and the next
+// gather is waited for.
+func runExecd(ctx context.Context, r io.Reader, collectors []collector, out output) error {
+	lines := make(chan struct{})
+	errs := make(chan error, 1)
+
+	go func() {
+		scanner := bufio.NewScanner(r)
+
+		for scanner.Scan() {
+			select {
+			case lines <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		errs <- scanner.Err()
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-errs:
+			return err
+		case <-lines:
+		}
+
+		var points []*write.Point
+
+		written := true
+
+		for _, col := range collectors {
+			p, err := col.collect(ctx)
+			if err != nil {
+				log.Printf("%s: %v", col.name, err)
+
+				written = false
+			}
+
+			points = append(points, p...)
+		}
+
+		if err := out.write(ctx, points); err != nil {
+			log.Printf("output: %v", err)
+
+			written = false
+		}
+
+		for _, col := range collectors {
+			if col.done == nil {
+				continue
+			}
+
+			if err := col.done(written); err != nil {
+				log.Printf("%s: %v", col.name, err)
+			}
+		}
+	}
+}
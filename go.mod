@@ -3,12 +3,14 @@ module github.com/steveh/telegraf-exec-fronius
 go 1.17
 
 require (
+	github.com/eclipse/paho.mqtt.golang v1.3.5
 	github.com/influxdata/influxdb-client-go/v2 v2.6.0
 	golang.org/x/net v0.0.0-20211215060638-4ddde0e984e9
 )
 
 require (
 	github.com/deepmap/oapi-codegen v1.8.2 // indirect
+	github.com/gorilla/websocket v1.4.2 // indirect
 	github.com/influxdata/line-protocol v0.0.0-20200327222509-2487e7298839 // indirect
 	github.com/pkg/errors v0.9.1 // indirect
 	gopkg.in/yaml.v2 v2.3.0 // indirect
@@ -0,0 +1,321 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
+	ihttp "github.com/influxdata/influxdb-client-go/v2/api/http"
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
+)
+
+const (
+	// influxRetryInterval is the delay before the first retry of a failed batch.
+	influxRetryInterval = time.Second
+
+	// influxMaxRetryInterval caps the exponential backoff between retries.
+	influxMaxRetryInterval = 30 * time.Second
+
+	// influxMaxSpoolLines caps the spool file; the oldest lines are dropped
+	// beyond it so an unreachable server cannot fill the disk.
+	influxMaxSpoolLines = 100000
+)
+
+// influxOutput writes points to an InfluxDB v2 bucket in batches.
+// Batches that still fail after retrying a transient error are appended
+// to a spool file and replayed before the next write. Batches the server
+// rejects are dropped, as resending them cannot succeed.
+//
+// Batches are posted through the client's HTTP service rather than its
+// write API, which hides the status code needed to tell the two apart.
+type influxOutput struct {
+	client  influxdb2.Client
+	url     string
+	gzip    bool
+	batch   int
+	retries int
+	spool   string
+}
+
+func newInfluxOutput(serverURL string, token string, org string, bucket string, batch uint, retries uint, gzip bool, spool string) *influxOutput {
+	client := influxdb2.NewClient(serverURL, token)
+
+	u, _ := url.Parse(client.HTTPService().ServerAPIURL())
+	u, _ = u.Parse("write")
+	u.RawQuery = url.Values{
+		"org":       {org},
+		"bucket":    {bucket},
+		"precision": {"ns"}, // matches precision
+
+	}.Encode()
+
+	return &influxOutput{
+		client:  client,
+		url:     u.String(),
+		gzip:    gzip,
+		batch:   int(batch),
+		retries: int(retries),
+		spool:   spool,
+	}
+}
+
+func (o *influxOutput) write(ctx context.Context, points []*write.Point) (err error) {
+	lines := make([]string, 0, len(points))
+
+	for _, p := range points {
+		lines = append(lines, strings.TrimSuffix(write.PointToLineProtocol(p, precision), "\n"))
+	}
+
+	if o.spool == "" {
+		return o.writeLines(ctx, lines)
+	}
+
+	if err = lock(o.spool); err != nil {
+		return err
+	}
+
+	defer func() {
+		if uErr := unlock(o.spool); err == nil {
+			err = uErr
+		}
+	}()
+
+	spooled, err := readSpool(o.spool)
+	if err != nil {
+		return err
+	}
+
+	lines = append(spooled, lines...)
+
+	wErr := o.writeLines(ctx, lines)
+
+	var unsent *unsentError
+	if errors.As(wErr, &unsent) {
+		lines = unsent.lines
+
+		if len(lines) > influxMaxSpoolLines {
+			log.Printf("dropping %d oldest spooled lines", len(lines)-influxMaxSpoolLines)
+
+			lines = lines[len(lines)-influxMaxSpoolLines:]
+		}
+
+		log.Printf("spooling %d lines after write failure: %v", len(lines), unsent.err)
+
+		return writeSpool(o.spool, lines)
+	}
+
+	if wErr != nil {
+		return wErr
+	}
+
+	return writeSpool(o.spool, nil)
+}
+
+// unsentError carries the lines that could not be written.
+type unsentError struct {
+	lines []string
+	err   error
+}
+
+func (e *unsentError) Error() string {
+	return fmt.Sprintf("%d lines not written: %v", len(e.lines), e.err)
+}
+
+func (e *unsentError) Unwrap() error {
+	return e.err
+}
+
+// writeLines writes lines in batches, retrying each batch with exponential
+// backoff. A batch the server rejects is logged and dropped; on any other
+// failure the remaining lines are returned in an unsentError.
+func (o *influxOutput) writeLines(ctx context.Context, lines []string) error {
+	for start := 0; start < len(lines); start += o.batch {
+		end := start + o.batch
+		if end > len(lines) {
+			end = len(lines)
+		}
+
+		err := o.writeBatch(ctx, lines[start:end])
+		if err == nil {
+			continue
+		}
+
+		if !retryable(err) {
+			log.Printf("dropping %d lines rejected by InfluxDB: %v", end-start, err)
+
+			continue
+		}
+
+		return &unsentError{lines: lines[start:], err: err}
+	}
+
+	return nil
+}
+
+// retryable reports whether a write may succeed when repeated: network
+// errors, rate limiting and server errors are, other HTTP errors are not.
+func retryable(err error) bool {
+	var httpErr *ihttp.Error
+	if !errors.As(err, &httpErr) || httpErr.StatusCode == 0 {
+		return true
+	}
+
+	return httpErr.StatusCode == 429 || httpErr.StatusCode >= 500
+}
+
+func (o *influxOutput) writeBatch(ctx context.Context, lines []string) (err error) {
+	body, err := o.body(lines)
+	if err != nil {
+		return err
+	}
+
+	delay := influxRetryInterval
+
+	for attempt := 0; ; attempt++ {
+		err = o.post(ctx, body)
+		if err == nil || attempt >= o.retries || !retryable(err) {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+
+		delay *= 2
+		if delay > influxMaxRetryInterval {
+			delay = influxMaxRetryInterval
+		}
+	}
+}
+
+// body returns the request body for lines, compressed if enabled.
+func (o *influxOutput) body(lines []string) ([]byte, error) {
+	data := []byte(strings.Join(lines, "\n") + "\n")
+
+	if !o.gzip {
+		return data, nil
+	}
+
+	var buf bytes.Buffer
+
+	w := gzip.NewWriter(&buf)
+
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// post sends one write request. Failures are returned as *ihttp.Error so
+// that retryable can inspect the status code.
+func (o *influxOutput) post(ctx context.Context, body []byte) error {
+	err := o.client.HTTPService().DoPostRequest(ctx, o.url, bytes.NewReader(body), func(req *http.Request) {
+		req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+
+		if o.gzip {
+			req.Header.Set("Content-Encoding", "gzip")
+		}
+	}, func(*http.Response) error {
+		return nil
+	})
+	// a nil *ihttp.Error must not be returned as a non-nil error
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (o *influxOutput) close() error {
+	o.client.Close()
+
+	return nil
+}
+
+// readSpool returns the lines in the spool file.
+func readSpool(path string) (lines []string, err error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if cErr := f.Close(); cErr != nil {
+			err = cErr
+		}
+	}()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		if line := scanner.Text(); line != "" {
+			lines = append(lines, line)
+		}
+	}
+
+	return lines, scanner.Err()
+}
+
+// writeSpool replaces the spool file with lines, removing it when there are none.
+func writeSpool(path string, lines []string) error {
+	if len(lines) == 0 {
+		err := os.Remove(path)
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(tmp)
+
+	for _, line := range lines {
+		if _, err = w.WriteString(line + "\n"); err != nil {
+			break
+		}
+	}
+
+	if err == nil {
+		err = w.Flush()
+	}
+
+	if cErr := tmp.Close(); err == nil {
+		err = cErr
+	}
+
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
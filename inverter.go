@@ -2,15 +2,11 @@ package main
 
 import (
 	"context"
-	"encoding/json"
-	"fmt"
-	"net/http"
 	"net/url"
 	"time"
 
 	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
 	"github.com/influxdata/influxdb-client-go/v2/api/write"
-	"golang.org/x/net/context/ctxhttp"
 )
 
 type inverterRealtimeResponse struct {
@@ -27,58 +23,31 @@ type inverterRealtimeResponse struct {
 			} `json:"DeviceStatus"`
 
 			// AC current (absolute, accumulated over all lines)
-			CurrentAC struct {
-				Unit  string  `json:"Unit"`
-				Value float64 `json:"Value"`
-			} `json:"IAC"`
+			CurrentAC unitValue `json:"IAC"`
 
 			// DC current
-			CurrentDC struct {
-				Unit  string  `json:"Unit"`
-				Value float64 `json:"Value"`
-			} `json:"IDC"`
+			CurrentDC unitValue `json:"IDC"`
 
 			// AC voltage
-			VoltageAC struct {
-				Unit  string  `json:"Unit"`
-				Value float64 `json:"Value"`
-			} `json:"UAC"`
+			VoltageAC unitValue `json:"UAC"`
 
 			// DC voltage
-			VoltageDC struct {
-				Unit  string  `json:"Unit"`
-				Value float64 `json:"Value"`
-			} `json:"UDC"`
+			VoltageDC unitValue `json:"UDC"`
 
 			// AC power (negative value for consuming power)
-			PowerAC struct {
-				Unit  string  `json:"Unit"`
-				Value float64 `json:"Value"`
-			} `json:"PAC"`
+			PowerAC unitValue `json:"PAC"`
 
 			// AC frequency
-			FrequencyAC struct {
-				Unit  string  `json:"Unit"`
-				Value float64 `json:"Value"`
-			} `json:"FAC"`
+			FrequencyAC unitValue `json:"FAC"`
 
 			// AC Energy generated on current day
-			EnergyDayAC struct {
-				Unit  string  `json:"Unit"`
-				Value float64 `json:"Value"`
-			} `json:"DAY_ENERGY"`
+			EnergyDayAC unitValue `json:"DAY_ENERGY"`
 
 			// AC Energy generated in current year
-			EnergyYearAC struct {
-				Unit  string  `json:"Unit"`
-				Value float64 `json:"Value"`
-			} `json:"YEAR_ENERGY"`
+			EnergyYearAC unitValue `json:"YEAR_ENERGY"`
 
 			// AC Energy generated overall
-			EnergyTotalAC struct {
-				Unit  string  `json:"Unit"`
-				Value float64 `json:"Value"`
-			} `json:"TOTAL_ENERGY"`
+			EnergyTotalAC unitValue `json:"TOTAL_ENERGY"`
 		} `json:"Data"`
 	} `json:"Body"`
 	Head head `json:"head"`
@@ -88,81 +57,158 @@ type inverterMinMaxResponse struct {
 	Body struct {
 		Data struct {
 			// Maximum AC power of current day
-			PowerDayMaxAC struct {
-				Unit  string  `json:"Unit"`
-				Value float64 `json:"Value"`
-			} `json:"DAY_PMAX"`
+			PowerDayMaxAC unitValue `json:"DAY_PMAX"`
 
 			// Maximum AC voltage of current day
-			VoltageDayMaxAC struct {
-				Unit  string  `json:"Unit"`
-				Value float64 `json:"Value"`
-			} `json:"DAY_UACMAX"`
+			VoltageDayMaxAC unitValue `json:"DAY_UACMAX"`
 
 			// Minimum AC voltage of current day
-			VoltageDayMinAC struct {
-				Unit  string  `json:"Unit"`
-				Value float64 `json:"Value"`
-			} `json:"DAY_UACMIN"`
+			VoltageDayMinAC unitValue `json:"DAY_UACMIN"`
 
 			// Maximum DC voltage of current day
-			VoltageDayMaxDC struct {
-				Unit  string  `json:"Unit"`
-				Value float64 `json:"Value"`
-			} `json:"DAY_UDCMAX"`
+			VoltageDayMaxDC unitValue `json:"DAY_UDCMAX"`
 
 			// Maximum AC power of current year
-			PowerYearMaxAC struct {
-				Unit  string  `json:"Unit"`
-				Value float64 `json:"Value"`
-			} `json:"YEAR_PMAX"`
+			PowerYearMaxAC unitValue `json:"YEAR_PMAX"`
 
 			// Maximum AC voltage of current year
-			VoltageYearMaxAC struct {
-				Unit  string  `json:"Unit"`
-				Value float64 `json:"Value"`
-			} `json:"YEAR_UACMAX"`
+			VoltageYearMaxAC unitValue `json:"YEAR_UACMAX"`
 
 			// Minimum AC voltage of current year
-			VoltageYearMinAC struct {
-				Unit  string  `json:"Unit"`
-				Value float64 `json:"Value"`
-			} `json:"YEAR_UACMIN"`
+			VoltageYearMinAC unitValue `json:"YEAR_UACMIN"`
 
 			// Maximum DC voltage of current year
-			VoltageYearMaxDC struct {
-				Unit  string  `json:"Unit"`
-				Value float64 `json:"Value"`
-			} `json:"YEAR_UDCMAX"`
+			VoltageYearMaxDC unitValue `json:"YEAR_UDCMAX"`
 
 			// Maximum AC power overall
-			PowerTotalMaxAC struct {
-				Unit  string  `json:"Unit"`
-				Value float64 `json:"Value"`
-			} `json:"TOTAL_PMAX"`
+			PowerTotalMaxAC unitValue `json:"TOTAL_PMAX"`
 
 			// Maximum AC voltage overall
-			VoltageTotalMaxAC struct {
-				Unit  string  `json:"Unit"`
-				Value float64 `json:"Value"`
-			} `json:"TOTAL_UACMAX"`
+			VoltageTotalMaxAC unitValue `json:"TOTAL_UACMAX"`
 
 			// Minimum AC voltage overall
-			VoltageTotalMinAC struct {
-				Unit  string  `json:"Unit"`
-				Value float64 `json:"Value"`
-			} `json:"TOTAL_UACMIN"`
+			VoltageTotalMinAC unitValue `json:"TOTAL_UACMIN"`
 
 			// Maximum DC voltage overall
-			VoltageTotalMaxDC struct {
-				Unit  string  `json:"Unit"`
-				Value float64 `json:"Value"`
-			} `json:"TOTAL_UDCMAX"`
+			VoltageTotalMaxDC unitValue `json:"TOTAL_UDCMAX"`
 		} `json:"Data"`
 	} `json:"Body"`
 	Head head `json:"head"`
 }
 
+type inverterThreePhaseResponse struct {
+	Body struct {
+		Data struct {
+			// AC current phase 1
+			CurrentACL1 unitValue `json:"IAC_L1"`
+
+			// AC current phase 2
+			CurrentACL2 unitValue `json:"IAC_L2"`
+
+			// AC current phase 3
+			CurrentACL3 unitValue `json:"IAC_L3"`
+
+			// AC voltage phase 1
+			VoltageACL1 unitValue `json:"UAC_L1"`
+
+			// AC voltage phase 2
+			VoltageACL2 unitValue `json:"UAC_L2"`
+
+			// AC voltage phase 3
+			VoltageACL3 unitValue `json:"UAC_L3"`
+
+			// Ambient temperature (not supported by all inverters)
+			TemperatureAmbient unitValue `json:"T_AMBIENT"`
+
+			// Fan speeds in percent of maximum (not supported by all inverters)
+			FanFrontLeft unitValue `json:"ROTATION_SPEED_FAN_FL"`
+
+			FanFrontRight unitValue `json:"ROTATION_SPEED_FAN_FR"`
+
+			FanBackLeft unitValue `json:"ROTATION_SPEED_FAN_BL"`
+
+			FanBackRight unitValue `json:"ROTATION_SPEED_FAN_BR"`
+		} `json:"Data"`
+	} `json:"Body"`
+	Head head `json:"head"`
+}
+
+type inverterCumulationResponse struct {
+	Body struct {
+		Data struct {
+			// Status information about inverter
+			DeviceStatus struct {
+				ErrorCode  int `json:"ErrorCode"`
+				StatusCode int `json:"StatusCode"`
+			} `json:"DeviceStatus"`
+
+			// AC power (negative value for consuming power)
+			PowerAC unitValue `json:"PAC"`
+
+			// AC Energy generated on current day
+			EnergyDayAC unitValue `json:"DAY_ENERGY"`
+
+			// AC Energy generated in current year
+			EnergyYearAC unitValue `json:"YEAR_ENERGY"`
+
+			// AC Energy generated overall
+			EnergyTotalAC unitValue `json:"TOTAL_ENERGY"`
+		} `json:"Data"`
+	} `json:"Body"`
+	Head head `json:"head"`
+}
+
+// inverterStatus maps DeviceStatus.StatusCode to the documented state names.
+func inverterStatus(code int) string {
+	switch {
+	case code >= 0 && code <= 6:
+		return "Startup"
+	case code == 7:
+		return "Running"
+	case code == 8:
+		return "Standby"
+	case code == 9:
+		return "Bootloading"
+	case code == 10:
+		return "Error"
+	case code == 11:
+		return "Idle"
+	case code == 12:
+		return "Ready"
+	case code == 13:
+		return "Sleeping"
+	case code == 255:
+		return "Unknown"
+	default:
+		return "Invalid"
+	}
+}
+
+// ledColors maps DeviceStatus.LEDColor to a color name.
+var ledColors = map[int]string{
+	0: "none",
+	1: "red",
+	2: "green",
+	3: "orange",
+}
+
+// ledStates maps DeviceStatus.LEDState to a state name.
+var ledStates = map[int]string{
+	0: "on",
+	1: "blinking",
+	2: "alternating",
+	3: "off",
+}
+
+// lookupName returns the name for code, or "unknown".
+func lookupName(names map[int]string, code int) string {
+	if name, ok := names[code]; ok {
+		return name
+	}
+
+	return "unknown"
+}
+
 // InverterRealtime returns realtime inverter data.
 func (c Client) InverterRealtime(ctx context.Context, deviceID string) (points []*write.Point, err error) {
 	var r inverterRealtimeResponse
@@ -173,24 +219,109 @@ func (c Client) InverterRealtime(ctx context.Context, deviceID string) (points [
 	q.Set("DeviceId", deviceID)
 	q.Set("DataCollection", "CommonInverterData")
 
-	u := url.URL{Scheme: "http", Host: c.host, Path: "/solar_api/v1/GetInverterRealtimeData.cgi", RawQuery: q.Encode()}
+	err = c.get(ctx, "/solar_api/v1/GetInverterRealtimeData.cgi", q, &r)
+	if err != nil {
+		return points, err
+	}
+
+	status := r.Body.Data.DeviceStatus
+
+	tags := map[string]string{
+		"device_id": deviceID,
+	}
+
+	values := map[string]interface{}{
+		"error_code":                status.ErrorCode,
+		"led_color":                 status.LEDColor,
+		"led_color_name":            lookupName(ledColors, status.LEDColor),
+		"led_state":                 status.LEDState,
+		"led_state_name":            lookupName(ledStates, status.LEDState),
+		"mgmt_timer_remaining_time": status.MgmtTimerRemainingTime,
+		"state_to_reset":            status.StateToReset,
+		"status_code":               status.StatusCode,
+		"status_name":               inverterStatus(status.StatusCode),
+	}
 
-	res, err := ctxhttp.Get(ctx, c.client, u.String())
+	// measurements are null or absent while the inverter is not feeding in
+	err = c.units.addUnits(values, map[string]unitValue{
+		"current_ac":      r.Body.Data.CurrentAC,
+		"current_dc":      r.Body.Data.CurrentDC,
+		"voltage_ac":      r.Body.Data.VoltageAC,
+		"voltage_dc":      r.Body.Data.VoltageDC,
+		"power_ac":        r.Body.Data.PowerAC,
+		"frequency_ac":    r.Body.Data.FrequencyAC,
+		"energy_day_ac":   r.Body.Data.EnergyDayAC,
+		"energy_year_ac":  r.Body.Data.EnergyYearAC,
+		"energy_total_ac": r.Body.Data.EnergyTotalAC,
+	})
 	if err != nil {
 		return points, err
 	}
 
-	defer func() {
-		if cErr := res.Body.Close(); cErr != nil {
-			err = cErr
-		}
-	}()
+	return []*write.Point{
+		influxdb2.NewPoint("inverter", tags, values, r.Head.Timestamp),
+	}, nil
+}
+
+// InverterThreePhase returns realtime per-phase inverter data.
+func (c Client) InverterThreePhase(ctx context.Context, deviceID string) (points []*write.Point, err error) {
+	var r inverterThreePhaseResponse
+
+	q := url.Values{}
 
-	if res.StatusCode != http.StatusOK {
-		return points, fmt.Errorf("%w: %d", ErrStatusNotOk, res.StatusCode)
+	q.Set("Scope", "Device")
+	q.Set("DeviceId", deviceID)
+	q.Set("DataCollection", "3PInverterData")
+
+	err = c.get(ctx, "/solar_api/v1/GetInverterRealtimeData.cgi", q, &r)
+	if err != nil {
+		return points, err
 	}
 
-	err = json.NewDecoder(res.Body).Decode(&r)
+	tags := map[string]string{
+		"device_id": deviceID,
+	}
+
+	values := map[string]interface{}{}
+
+	// temperature and fan speeds are not supported by all inverters
+	err = c.units.addUnits(values, map[string]unitValue{
+		"current_ac_l1":       r.Body.Data.CurrentACL1,
+		"current_ac_l2":       r.Body.Data.CurrentACL2,
+		"current_ac_l3":       r.Body.Data.CurrentACL3,
+		"voltage_ac_l1":       r.Body.Data.VoltageACL1,
+		"voltage_ac_l2":       r.Body.Data.VoltageACL2,
+		"voltage_ac_l3":       r.Body.Data.VoltageACL3,
+		"temperature_ambient": r.Body.Data.TemperatureAmbient,
+		"fan_front_left":      r.Body.Data.FanFrontLeft,
+		"fan_front_right":     r.Body.Data.FanFrontRight,
+		"fan_back_left":       r.Body.Data.FanBackLeft,
+		"fan_back_right":      r.Body.Data.FanBackRight,
+	})
+	if err != nil {
+		return points, err
+	}
+
+	if len(values) == 0 {
+		return points, nil
+	}
+
+	return []*write.Point{
+		influxdb2.NewPoint("inverter_3p", tags, values, r.Head.Timestamp),
+	}, nil
+}
+
+// InverterCumulation returns realtime cumulated inverter data.
+func (c Client) InverterCumulation(ctx context.Context, deviceID string) (points []*write.Point, err error) {
+	var r inverterCumulationResponse
+
+	q := url.Values{}
+
+	q.Set("Scope", "Device")
+	q.Set("DeviceId", deviceID)
+	q.Set("DataCollection", "CumulationInverterData")
+
+	err = c.get(ctx, "/solar_api/v1/GetInverterRealtimeData.cgi", q, &r)
 	if err != nil {
 		return points, err
 	}
@@ -200,19 +331,23 @@ func (c Client) InverterRealtime(ctx context.Context, deviceID string) (points [
 	}
 
 	values := map[string]interface{}{
-		"current_ac":      r.Body.Data.CurrentAC.Value,
-		"current_dc":      r.Body.Data.CurrentDC.Value,
-		"voltage_ac":      r.Body.Data.VoltageAC.Value,
-		"voltage_dc":      r.Body.Data.VoltageDC.Value,
-		"power_ac":        r.Body.Data.PowerAC.Value,
-		"frequency_ac":    r.Body.Data.FrequencyAC.Value,
-		"energy_day_ac":   r.Body.Data.EnergyDayAC.Value,
-		"energy_year_ac":  r.Body.Data.EnergyYearAC.Value,
-		"energy_total_ac": r.Body.Data.EnergyTotalAC.Value,
+		"error_code":  r.Body.Data.DeviceStatus.ErrorCode,
+		"status_code": r.Body.Data.DeviceStatus.StatusCode,
+		"status_name": inverterStatus(r.Body.Data.DeviceStatus.StatusCode),
+	}
+
+	err = c.units.addUnits(values, map[string]unitValue{
+		"power_ac":        r.Body.Data.PowerAC,
+		"energy_day_ac":   r.Body.Data.EnergyDayAC,
+		"energy_year_ac":  r.Body.Data.EnergyYearAC,
+		"energy_total_ac": r.Body.Data.EnergyTotalAC,
+	})
+	if err != nil {
+		return points, err
 	}
 
 	return []*write.Point{
-		influxdb2.NewPoint("fronius_inverter", tags, values, r.Head.Timestamp),
+		influxdb2.NewPoint("inverter_cumulation", tags, values, r.Head.Timestamp),
 	}, nil
 }
 
@@ -226,68 +361,51 @@ func (c Client) InverterMinMax(ctx context.Context, deviceID string) (points []*
 	q.Set("DeviceId", deviceID)
 	q.Set("DataCollection", "MinMaxInverterData")
 
-	u := url.URL{Scheme: "http", Host: c.host, Path: "/solar_api/v1/GetInverterRealtimeData.cgi", RawQuery: q.Encode()}
-
-	res, err := ctxhttp.Get(ctx, c.client, u.String())
+	err = c.get(ctx, "/solar_api/v1/GetInverterRealtimeData.cgi", q, &r)
 	if err != nil {
 		return points, err
 	}
 
-	defer func() {
-		if cErr := res.Body.Close(); cErr != nil {
-			err = cErr
-		}
-	}()
-
-	if res.StatusCode != http.StatusOK {
-		return points, fmt.Errorf("%w: %d", ErrStatusNotOk, res.StatusCode)
+	tags := map[string]string{
+		"device_id": deviceID,
 	}
 
-	err = json.NewDecoder(res.Body).Decode(&r)
+	values := map[string]interface{}{}
+
+	err = c.units.addUnits(values, map[string]unitValue{
+		"power_day_max_ac":     r.Body.Data.PowerDayMaxAC,
+		"voltage_day_max_ac":   r.Body.Data.VoltageDayMaxAC,
+		"voltage_day_min_ac":   r.Body.Data.VoltageDayMinAC,
+		"voltage_day_max_dc":   r.Body.Data.VoltageDayMaxDC,
+		"power_year_max_ac":    r.Body.Data.PowerYearMaxAC,
+		"voltage_year_max_ac":  r.Body.Data.VoltageYearMaxAC,
+		"voltage_year_min_ac":  r.Body.Data.VoltageYearMinAC,
+		"voltage_year_max_dc":  r.Body.Data.VoltageYearMaxDC,
+		"power_total_max_ac":   r.Body.Data.PowerTotalMaxAC,
+		"voltage_total_max_ac": r.Body.Data.VoltageTotalMaxAC,
+		"voltage_total_min_ac": r.Body.Data.VoltageTotalMinAC,
+		"voltage_total_max_dc": r.Body.Data.VoltageTotalMaxDC,
+	})
 	if err != nil {
 		return points, err
 	}
 
-	tags := map[string]string{
-		"device_id": deviceID,
-	}
-
-	values := map[string]interface{}{
-		"power_day_max_ac":     r.Body.Data.PowerDayMaxAC.Value,
-		"voltage_day_max_ac":   r.Body.Data.VoltageDayMaxAC.Value,
-		"voltage_day_min_ac":   r.Body.Data.VoltageDayMinAC.Value,
-		"voltage_day_max_dc":   r.Body.Data.VoltageDayMaxDC.Value,
-		"power_year_max_ac":    r.Body.Data.PowerYearMaxAC.Value,
-		"voltage_year_max_ac":  r.Body.Data.VoltageYearMaxAC.Value,
-		"voltage_year_min_ac":  r.Body.Data.VoltageYearMinAC.Value,
-		"voltage_year_max_dc":  r.Body.Data.VoltageYearMaxDC.Value,
-		"power_total_max_ac":   r.Body.Data.PowerTotalMaxAC.Value,
-		"voltage_total_max_ac": r.Body.Data.VoltageTotalMaxAC.Value,
-		"voltage_total_min_ac": r.Body.Data.VoltageTotalMinAC.Value,
-		"voltage_total_max_dc": r.Body.Data.VoltageTotalMaxDC.Value,
+	if len(values) == 0 {
+		return points, nil
 	}
 
 	return []*write.Point{
-		influxdb2.NewPoint("fronius_inverter_minmax", tags, values, r.Head.Timestamp),
+		influxdb2.NewPoint("inverter_minmax", tags, values, r.Head.Timestamp),
 	}, nil
 }
 
 // InverterArchive returns historical inverter data.
-func (c Client) InverterArchive(ctx context.Context, deviceID string, startDate time.Time, endDate time.Time) (points []*write.Point, err error) {
-	q := defaultValues()
+func (c Client) InverterArchive(ctx context.Context, deviceID string, startDate time.Time, endDate time.Time, opts ArchiveOptions) (points []*write.Point, err error) {
+	q := url.Values{}
 
 	q.Set("Scope", "Device")
-	q.Set("SeriesType", "Detail")
-	q.Set("HumanReadable", "False")
 	q.Set("DeviceClass", "Inverter")
 	q.Set("DeviceId", deviceID)
-	q.Set("StartDate", startDate.Format("2006-01-02"))
-	q.Set("EndDate", endDate.Format("2006-01-02"))
-
-	r, err := c.readArchive(ctx, q)
-	if err != nil {
-		return points, err
-	}
 
-	return generateArchivePoints(r, "inverter_archive")
+	return c.archive(ctx, q, startDate, endDate, opts, "inverter_archive")
 }
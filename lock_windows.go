@@ -0,0 +1,32 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// errSharingViolation is ERROR_SHARING_VIOLATION, returned when another
+// handle has the file open without sharing.
+const errSharingViolation syscall.Errno = 32
+
+// tryLock opens the lock file at path without sharing it, returning
+// errLockHeld when another handle has it open. Windows closes the handle,
+// and so releases the lock, when the process exits.
+func tryLock(path string) (*os.File, error) {
+	name, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return nil, err
+	}
+
+	h, err := syscall.CreateFile(name, syscall.GENERIC_READ|syscall.GENERIC_WRITE, 0, nil, syscall.OPEN_ALWAYS, syscall.FILE_ATTRIBUTE_NORMAL, 0)
+	if errors.Is(err, errSharingViolation) {
+		return nil, errLockHeld
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return os.NewFile(uintptr(h), path), nil
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"strconv"
+
+	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
+)
+
+// APIVersion is the Solar API version supported by the datalogger.
+type APIVersion struct {
+	APIVersion         int    `json:"APIVersion"`
+	BaseURL            string `json:"BaseURL"`
+	CompatibilityRange string `json:"CompatibilityRange"`
+}
+
+type loggerInfoResponse struct {
+	Body struct {
+		LoggerInfo struct {
+			// CO2 factor and unit used for the CO2 savings calculation
+			CO2Factor float64 `json:"CO2Factor"`
+			CO2Unit   string  `json:"CO2Unit"`
+
+			// cash factor and currency used for the earnings calculation
+			CashCurrency string  `json:"CashCurrency"`
+			CashFactor   float64 `json:"CashFactor"`
+
+			DefaultLanguage string `json:"DefaultLanguage"`
+
+			// feed-in tariff
+			DeliveryFactor float64 `json:"DeliveryFactor"`
+
+			HWVersion  string `json:"HWVersion"`
+			SWVersion  string `json:"SWVersion"`
+			PlatformID string `json:"PlatformID"`
+			ProductID  string `json:"ProductID"`
+
+			// e.g. "Vienna" and "CET"
+			TimezoneLocation string `json:"TimezoneLocation"`
+			TimezoneName     string `json:"TimezoneName"`
+
+			// offset from UTC in seconds
+			UTCOffset int `json:"UTCOffset"`
+
+			UniqueID string `json:"UniqueID"`
+		} `json:"LoggerInfo"`
+	} `json:"Body"`
+	Head head `json:"head"`
+}
+
+type loggerLED struct {
+	// "none", "off", "green", "yellow", "orange" or "red"
+	Color string `json:"Color"`
+
+	// "off", "on", "blinking" or "alternating"
+	State string `json:"State"`
+}
+
+type loggerLEDInfoResponse struct {
+	Body struct {
+		Data struct {
+			PowerLED    loggerLED `json:"PowerLED"`
+			SolarNetLED loggerLED `json:"SolarNetLED"`
+			SolarWebLED loggerLED `json:"SolarWebLED"`
+			WLANLED     loggerLED `json:"WLANLED"`
+		} `json:"Data"`
+	} `json:"Body"`
+	Head head `json:"head"`
+}
+
+// loggerLEDColors maps LED colors to codes ordered by severity.
+var loggerLEDColors = map[string]int{
+	"none":   0,
+	"off":    0,
+	"green":  1,
+	"yellow": 2,
+	"orange": 3,
+	"red":    4,
+}
+
+// loggerLEDStates maps LED states to codes.
+var loggerLEDStates = map[string]int{
+	"off":         0,
+	"on":          1,
+	"blinking":    2,
+	"alternating": 3,
+}
+
+// lookupCode returns the code for name, or -1.
+func lookupCode(codes map[string]int, name string) int {
+	if code, ok := codes[name]; ok {
+		return code
+	}
+
+	return -1
+}
+
+// APIVersion returns the Solar API version supported by the datalogger.
+func (c Client) APIVersion(ctx context.Context) (result APIVersion, err error) {
+	err = c.get(ctx, "/solar_api/GetAPIVersion.cgi", nil, &result)
+
+	return result, err
+}
+
+// LoggerInfo returns datalogger and API version information. The uptime of
+// the datalogger is not included, as neither GetLoggerInfo.cgi nor any other
+// Solar API v1 endpoint reports it.
+func (c Client) LoggerInfo(ctx context.Context) (points []*write.Point, err error) {
+	var r loggerInfoResponse
+
+	version, err := c.APIVersion(ctx)
+	if err != nil {
+		return points, err
+	}
+
+	err = c.get(ctx, "/solar_api/v1/GetLoggerInfo.cgi", nil, &r)
+	if err != nil {
+		return points, err
+	}
+
+	info := r.Body.LoggerInfo
+
+	tags := map[string]string{
+		"api_version": strconv.Itoa(version.APIVersion),
+	}
+
+	// older firmware leaves some of these out
+	addTags(tags, map[string]string{
+		"unique_id":           info.UniqueID,
+		"product_id":          info.ProductID,
+		"platform_id":         info.PlatformID,
+		"hw_version":          info.HWVersion,
+		"sw_version":          info.SWVersion,
+		"compatibility_range": version.CompatibilityRange,
+	})
+
+	values := map[string]interface{}{
+		"utc_offset":        info.UTCOffset,
+		"timezone_name":     info.TimezoneName,
+		"timezone_location": info.TimezoneLocation,
+		"default_language":  info.DefaultLanguage,
+		"co2_factor":        info.CO2Factor,
+		"co2_unit":          info.CO2Unit,
+		"cash_factor":       info.CashFactor,
+		"cash_currency":     info.CashCurrency,
+		"delivery_factor":   info.DeliveryFactor,
+	}
+
+	return []*write.Point{
+		influxdb2.NewPoint("logger", tags, values, r.Head.Timestamp),
+	}, nil
+}
+
+// LoggerLEDInfo returns the color and state of each datalogger LED.
+func (c Client) LoggerLEDInfo(ctx context.Context) (points []*write.Point, err error) {
+	var r loggerLEDInfoResponse
+
+	err = c.get(ctx, "/solar_api/v1/GetLoggerLEDInfo.cgi", nil, &r)
+	if err != nil {
+		return points, err
+	}
+
+	leds := map[string]loggerLED{
+		"power":     r.Body.Data.PowerLED,
+		"solar_net": r.Body.Data.SolarNetLED,
+		"solar_web": r.Body.Data.SolarWebLED,
+		"wlan":      r.Body.Data.WLANLED,
+	}
+
+	for name, led := range leds {
+		tags := map[string]string{
+			"led": name,
+		}
+
+		values := map[string]interface{}{
+			"color":      led.Color,
+			"color_code": lookupCode(loggerLEDColors, led.Color),
+			"state":      led.State,
+			"state_code": lookupCode(loggerLEDStates, led.State),
+		}
+
+		point := influxdb2.NewPoint("logger_led", tags, values, r.Head.Timestamp)
+
+		points = append(points, point)
+	}
+
+	return points, nil
+}
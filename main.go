@@ -3,9 +3,13 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/influxdata/influxdb-client-go/v2/api/write"
@@ -16,96 +20,301 @@ const (
 )
 
 var (
-	host     string
-	inverter string
-	meter    string
-	system   bool
-	realtime bool
-	archive  bool
-	days     uint
+	host       string
+	inverter   string
+	meter      string
+	sensor     string
+	stringCtl  string
+	system     bool
+	logger     bool
+	leds       bool
+	storage    bool
+	ohmPilot   bool
+	realtime   bool
+	threePhase bool
+	cumulation bool
+	archive    bool
+	days       uint
+	channels   string
+	seriesType string
+	statePath  string
+	overlap    time.Duration
+	discover   bool
+	format     string
+	listen     string
+	interval   time.Duration
+	intervals  string
+	execd      bool
+	units      string
+	prefix     string
+	namingMode string
+
+	outputMode    string
+	influxURL     string
+	influxOrg     string
+	influxBucket  string
+	influxToken   string
+	influxBatch   uint
+	influxRetries uint
+	influxGzip    bool
+	influxSpool   string
+
+	mqttBroker   string
+	mqttClientID string
+	mqttUsername string
+	mqttPassword string
+	mqttTopic    string
+	mqttQoS      uint
+	mqttRetain   bool
+	haDiscovery  string
 )
 
 func init() {
 	flag.StringVar(&host, "host", "localhost", "Fronius host")
-	flag.StringVar(&inverter, "inverter", "1", "Collect inverter data with device ID")
-	flag.StringVar(&meter, "meter", "0", "Collect meter data with device ID")
+	flag.StringVar(&inverter, "inverter", "1", "Collect inverter data with comma separated device IDs, or all")
+	flag.StringVar(&meter, "meter", "0", "Collect meter data with comma separated device IDs, or all")
+	flag.StringVar(&sensor, "sensor", "", "Collect sensor card data with comma separated device IDs, or all")
+	flag.StringVar(&stringCtl, "strings", "", "Collect String Control data with comma separated device IDs, or all")
 	flag.BoolVar(&system, "system", true, "Collect system data")
+	flag.BoolVar(&logger, "logger", false, "Collect datalogger information")
+	flag.BoolVar(&leds, "leds", false, "Collect datalogger LED status")
+	flag.BoolVar(&storage, "storage", false, "Collect storage data from all devices")
+	flag.BoolVar(&ohmPilot, "ohmpilot", false, "Collect Ohmpilot data from all devices")
 	flag.BoolVar(&realtime, "realtime", false, "Collect realtime data")
+	flag.BoolVar(&threePhase, "threephase", false, "Collect realtime per-phase inverter data")
+	flag.BoolVar(&cumulation, "cumulation", false, "Collect realtime cumulated inverter data")
 	flag.BoolVar(&archive, "archive", false, "Collect archive data")
 	flag.UintVar(&days, "days", 7, "Days of history to collect")
+	flag.StringVar(&channels, "channels", "all", "Archive channels or presets (all, energy, electrical, sensors, relays, status), comma separated")
+	flag.StringVar(&seriesType, "series", "Detail", "Archive series type: Detail or DailySum")
+	flag.StringVar(&statePath, "state", "", "Archive checkpoint file; only newer archive data is collected when set")
+	flag.DurationVar(&overlap, "overlap", time.Hour, "Archive data to collect again before the checkpoint")
+	flag.StringVar(&outputMode, "output", "stdout", "Output: stdout for line protocol, influx to write to InfluxDB v2, or mqtt to publish JSON")
+	flag.StringVar(&influxURL, "influx-url", "http://localhost:8086", "InfluxDB URL")
+	flag.StringVar(&influxOrg, "influx-org", "", "InfluxDB organization")
+	flag.StringVar(&influxBucket, "influx-bucket", "", "InfluxDB bucket")
+	flag.StringVar(&influxToken, "influx-token", "", "InfluxDB token (default $INFLUX_TOKEN)")
+	flag.UintVar(&influxBatch, "influx-batch", 5000, "Points per InfluxDB write")
+	flag.UintVar(&influxRetries, "influx-retries", 5, "Retries of a failed InfluxDB write")
+	flag.BoolVar(&influxGzip, "influx-gzip", true, "Compress InfluxDB writes with gzip")
+	flag.StringVar(&influxSpool, "influx-spool", "", "File to buffer failed InfluxDB writes in until the next run")
+	flag.StringVar(&mqttBroker, "mqtt-broker", "tcp://localhost:1883", "MQTT broker URL")
+	flag.StringVar(&mqttClientID, "mqtt-client-id", "telegraf-exec-fronius", "MQTT client ID")
+	flag.StringVar(&mqttUsername, "mqtt-username", "", "MQTT username")
+	flag.StringVar(&mqttPassword, "mqtt-password", "", "MQTT password (default $MQTT_PASSWORD)")
+	flag.StringVar(&mqttTopic, "mqtt-topic", "fronius", "MQTT topic prefix")
+	flag.UintVar(&mqttQoS, "mqtt-qos", 1, "MQTT QoS level")
+	flag.BoolVar(&mqttRetain, "mqtt-retain", false, "Retain published MQTT state messages")
+	flag.StringVar(&haDiscovery, "ha-discovery", "homeassistant", "Home Assistant MQTT discovery prefix; empty disables discovery")
+	flag.BoolVar(&discover, "discover", false, "Collect data from every device reported by the datalogger")
+	flag.StringVar(&listen, "listen", ":9775", "Address the serve command listens on")
+	flag.DurationVar(&interval, "interval", 0, "Collection interval of the serve command, and of daemon collectors without their own; serve collects on each scrape when 0")
+	flag.StringVar(&intervals, "intervals", "powerflow=5s,meter=10s,minmax=5m,archive=1h", "Daemon collector intervals as comma separated collector=duration pairs")
+	flag.StringVar(&prefix, "prefix", defaultPrefix, "Prefix of measurement names; only the default with -naming compat")
+	flag.StringVar(&namingMode, "naming", "default", "Naming scheme: default, or compat for the measurement and field names of earlier releases")
+	flag.StringVar(&units, "units", defaultUnits, "Comma separated units values are converted to, e.g. kW,kWh for kilowatts and kilowatt hours")
+	flag.BoolVar(&execd, "execd", false, "Collect each time a line is read from stdin, as signalled by the Telegraf execd input, until stdin is closed")
+	flag.StringVar(&format, "format", "table", "Output format of the discover command: table or json")
 }
 
+// exitHooks run before the process exits on an error.
+var exitHooks []func()
+
 func check(err error) {
-	if err != nil {
-		log.Fatal(err)
+	if err == nil {
+		return
+	}
+
+	for _, hook := range exitHooks {
+		hook()
+	}
+
+	var apiErr *APIError
+
+	if errors.As(err, &apiErr) {
+		log.Fatalf("datalogger returned an error: %v", err)
+	}
+
+	log.Fatal(err)
+}
+
+// newOutput returns the output selected by the output flags.
+func newOutput(units unitSystem, n naming) (output, error) {
+	switch outputMode {
+	case "stdout":
+		return namedOutput{output: lineOutput{w: os.Stdout}, naming: n}, nil
+	case "influx":
+		if influxBatch == 0 {
+			influxBatch = 1
+		}
+
+		out := newInfluxOutput(influxURL, influxToken, influxOrg, influxBucket, influxBatch, influxRetries, influxGzip, influxSpool)
+
+		return namedOutput{output: out, naming: n}, nil
+	case "mqtt":
+		return newMQTTOutput(mqttBroker, mqttClientID, mqttUsername, mqttPassword, mqttTopic, host, mqttQoS, mqttRetain, haDiscovery, units, n)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownFormat, outputMode)
+	}
+}
+
+// selectedCollectors returns the collectors of the long-running modes.
+func selectedCollectors(client Client, s selection) (collectors []collector) {
+	if realtime {
+		collectors = append(collectors, realtimeCollectors(client, s)...)
 	}
+
+	if archive {
+		collectors = append(collectors, minMaxCollector(client, s), archiveCollector(client, s, days, statePath, overlap))
+	}
+
+	return collectors
 }
 
 func main() {
 	flag.Parse()
 
+	// secrets are read from the environment after parsing so that -help
+	// does not print them as defaults
+	if influxToken == "" {
+		influxToken = os.Getenv("INFLUX_TOKEN")
+	}
+
+	if mqttPassword == "" {
+		mqttPassword = os.Getenv("MQTT_PASSWORD")
+	}
+
 	client := NewClient(host)
 
-	ctx := context.Background()
+	var err error
 
-	if realtime {
-		if inverter != "" {
-			inv_points, err := client.InverterRealtime(ctx, inverter)
-			check(err)
-			for _, p := range inv_points {
-				fmt.Print(write.PointToLineProtocol(p, precision))
-			}
+	client.units, err = parseUnits(units)
+	check(err)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if flag.Arg(0) == "discover" {
+		devices, err := client.Discover(ctx)
+		check(err)
+		check(printDevices(os.Stdout, devices, format))
+
+		return
+	}
+
+	s := selection{
+		storage:    storage,
+		ohmPilot:   ohmPilot,
+		system:     system,
+		logger:     logger,
+		leds:       leds,
+		threePhase: threePhase,
+		cumulation: cumulation,
+	}
+
+	n, err := parseNaming(namingMode, prefix)
+	check(err)
+
+	out, err := newOutput(client.units, n)
+	check(err)
+
+	exitHooks = append(exitHooks, func() { _ = out.close() })
+
+	s.archive.Channels, err = parseChannels(channels)
+	check(err)
+
+	s.archive.SeriesType, err = parseSeriesType(seriesType)
+	check(err)
+
+	if discover {
+		devices, err := client.Discover(ctx)
+		check(err)
+
+		s = s.discovered(devices)
+	} else {
+		s.inverters, err = resolveIDs(ctx, client, "Inverter", inverter)
+		check(err)
+
+		s.meters, err = resolveIDs(ctx, client, "Meter", meter)
+		check(err)
+
+		s.sensors, err = resolveIDs(ctx, client, "SensorCard", sensor)
+		check(err)
+
+		s.strings, err = resolveIDs(ctx, client, "StringControl", stringCtl)
+		check(err)
+	}
+
+	if flag.Arg(0) == "serve" {
+		check(serveMetrics(ctx, client, s, n, listen, interval))
+
+		return
+	}
+
+	if flag.Arg(0) == "daemon" {
+		daemonIntervals, err := parseIntervals(intervals)
+		check(err)
+
+		fallback := interval
+		if fallback == 0 {
+			fallback = defaultInterval
 		}
 
-		if meter != "" {
-			met_points, err := client.MeterRealtime(ctx, meter)
-			check(err)
-			for _, p := range met_points {
-				fmt.Print(write.PointToLineProtocol(p, precision))
-			}
+		collectors := selectedCollectors(client, s)
+		if len(collectors) == 0 {
+			check(ErrNoCollectors)
 		}
 
-		if system {
-			pow_points, err := client.PowerFlowRealtime(ctx)
-			check(err)
-			for _, p := range pow_points {
-				fmt.Print(write.PointToLineProtocol(p, precision))
-			}
+		runDaemon(ctx, collectors, daemonIntervals, fallback, out)
+		check(out.close())
+
+		return
+	}
+
+	if execd {
+		collectors := selectedCollectors(client, s)
+		if len(collectors) == 0 {
+			check(ErrNoCollectors)
 		}
+
+		check(runExecd(ctx, os.Stdin, collectors, out))
+		check(out.close())
+
+		return
 	}
 
+	var points []*write.Point
+
+	if realtime {
+		p, err := collectRealtime(ctx, client, s)
+		points = append(points, p...)
+		check(err)
+	}
+
+	var cp *checkpoint
+
 	if archive {
 		startDate := time.Now().AddDate(0, 0, 0-int(days))
 		endDate := time.Now()
 
-		if inverter != "" {
-			inv_points, err := client.InverterArchive(ctx, inverter, startDate, endDate)
+		if statePath != "" {
+			cp, err = openCheckpoint(statePath, overlap)
 			check(err)
-			for _, p := range inv_points {
-				fmt.Print(write.PointToLineProtocol(p, precision))
-			}
 
-			minmax, err := client.InverterMinMax(ctx, inverter)
-			check(err)
-			for _, p := range minmax {
-				fmt.Print(write.PointToLineProtocol(p, precision))
-			}
+			exitHooks = append(exitHooks, func() { _ = cp.close() })
 		}
 
-		if meter != "" {
-			met_points, err := client.MeterArchive(ctx, meter, startDate, endDate)
-			check(err)
-			for _, p := range met_points {
-				fmt.Print(write.PointToLineProtocol(p, precision))
-			}
-		}
+		p, err := collectArchive(ctx, client, s, startDate, endDate, cp)
+		points = append(points, p...)
+		check(err)
+	}
 
-		if system {
-			sys_points, err := client.SystemArchive(ctx, startDate, endDate)
-			check(err)
-			for _, p := range sys_points {
-				fmt.Print(write.PointToLineProtocol(p, precision))
-			}
-		}
+	check(out.write(ctx, points))
+
+	if cp != nil {
+		check(cp.save())
+		check(cp.close())
 	}
+
+	check(out.close())
 }
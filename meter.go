@@ -2,15 +2,12 @@ package main
 
 import (
 	"context"
-	"encoding/json"
-	"fmt"
-	"net/http"
 	"net/url"
+	"strconv"
 	"time"
 
 	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
 	"github.com/influxdata/influxdb-client-go/v2/api/write"
-	"golang.org/x/net/context/ctxhttp"
 )
 
 type meterRealtimeResponse struct {
@@ -28,7 +25,7 @@ type meterRealtimeResponse struct {
 			Timestamp int `json:"TimeStamp"`
 
 			// 1...use values, 0...incomplete or outdated values
-			Visible int `json:"Visible"`
+			Visible *int `json:"Visible"`
 
 			// 0...grid interconnection point (primary meter
 			// 1...load (primary meter)
@@ -37,46 +34,88 @@ type meterRealtimeResponse struct {
 			MeterLocationCurrent int `json:"Meter_Location_Current"`
 
 			// absolute values
-			CurrentACPhase1 float64 `json:"Current_AC_Phase_1"`
-			CurrentACSum    float64 `json:"Current_AC_Sum"`
+			CurrentACPhase1 *float64 `json:"Current_AC_Phase_1"`
+			CurrentACPhase2 *float64 `json:"Current_AC_Phase_2"`
+			CurrentACPhase3 *float64 `json:"Current_AC_Phase_3"`
+			CurrentACSum    *float64 `json:"Current_AC_Sum"`
 
 			// system specific view
-			EnergyRealWattsACMinusAbsolute float64 `json:"EnergyReal_WAC_Minus_Absolute"`
-			EnergyRealWattsACPlusAbsolute  float64 `json:"EnergyReal_WAC_Plus_Absolute"`
+			EnergyRealWattsACMinusAbsolute *float64 `json:"EnergyReal_WAC_Minus_Absolute"`
+			EnergyRealWattsACPlusAbsolute  *float64 `json:"EnergyReal_WAC_Plus_Absolute"`
 
 			// meter specific view
-			EnergyRealWattsACPhase1Consumed float64 `json:"EnergyReal_WAC_Phase_1_Consumed"`
-			EnergyRealWattsACPhase1Produced float64 `json:"EnergyReal_WAC_Phase_1_Produced"`
-			EnergyRealWattsACSumConsumed    float64 `json:"EnergyReal_WAC_Sum_Consumed"`
-			EnergyRealWattsACSumProduced    float64 `json:"EnergyReal_WAC_Sum_Produced"`
+			EnergyRealWattsACPhase1Consumed *float64 `json:"EnergyReal_WAC_Phase_1_Consumed"`
+			EnergyRealWattsACPhase1Produced *float64 `json:"EnergyReal_WAC_Phase_1_Produced"`
+			EnergyRealWattsACPhase2Consumed *float64 `json:"EnergyReal_WAC_Phase_2_Consumed"`
+			EnergyRealWattsACPhase2Produced *float64 `json:"EnergyReal_WAC_Phase_2_Produced"`
+			EnergyRealWattsACPhase3Consumed *float64 `json:"EnergyReal_WAC_Phase_3_Consumed"`
+			EnergyRealWattsACPhase3Produced *float64 `json:"EnergyReal_WAC_Phase_3_Produced"`
+			EnergyRealWattsACSumConsumed    *float64 `json:"EnergyReal_WAC_Sum_Consumed"`
+			EnergyRealWattsACSumProduced    *float64 `json:"EnergyReal_WAC_Sum_Produced"`
 
 			// meter specific view
-			EnergyReactiveVArACPhase1Consumed float64 `json:"EnergyReactive_VArAC_Phase_1_Consumed"`
-			EnergyReactiveVArACPhase1Produced float64 `json:"EnergyReactive_VArAC_Phase_1_Produced"`
-			EnergyReactiveVArACSumConsumed    float64 `json:"EnergyReactive_VArAC_Sum_Consumed"`
-			EnergyReactiveVArACSumProduced    float64 `json:"EnergyReactive_VArAC_Sum_Produced"`
-
-			FrequencyPhaseAverage float64 `json:"Frequency_Phase_Average"`
-
-			PowerApparentSPhase1 float64 `json:"PowerApparent_S_Phase_1"`
-			PowerApparentSSum    float64 `json:"PowerApparent_S_Sum"`
-
-			PowerFactorPhase1 float64 `json:"PowerFactor_Phase_1"`
-			PowerFactorSum    float64 `json:"PowerFactor_Sum"`
-
-			PowerReactiveQPhase1 float64 `json:"PowerReactive_Q_Phase_1"`
-			PowerReactiveQSum    float64 `json:"PowerReactive_Q_Sum"`
-
-			PowerRealPPhase1 float64 `json:"PowerReal_P_Phase_1"`
-			PowerRealPSum    float64 `json:"PowerReal_P_Sum"`
-
-			VoltageACPhase1 float64 `json:"Voltage_AC_Phase_1"`
+			EnergyReactiveVArACPhase1Consumed *float64 `json:"EnergyReactive_VArAC_Phase_1_Consumed"`
+			EnergyReactiveVArACPhase1Produced *float64 `json:"EnergyReactive_VArAC_Phase_1_Produced"`
+			EnergyReactiveVArACPhase2Consumed *float64 `json:"EnergyReactive_VArAC_Phase_2_Consumed"`
+			EnergyReactiveVArACPhase2Produced *float64 `json:"EnergyReactive_VArAC_Phase_2_Produced"`
+			EnergyReactiveVArACPhase3Consumed *float64 `json:"EnergyReactive_VArAC_Phase_3_Consumed"`
+			EnergyReactiveVArACPhase3Produced *float64 `json:"EnergyReactive_VArAC_Phase_3_Produced"`
+			EnergyReactiveVArACSumConsumed    *float64 `json:"EnergyReactive_VArAC_Sum_Consumed"`
+			EnergyReactiveVArACSumProduced    *float64 `json:"EnergyReactive_VArAC_Sum_Produced"`
+
+			FrequencyPhaseAverage *float64 `json:"Frequency_Phase_Average"`
+
+			PowerApparentSPhase1 *float64 `json:"PowerApparent_S_Phase_1"`
+			PowerApparentSPhase2 *float64 `json:"PowerApparent_S_Phase_2"`
+			PowerApparentSPhase3 *float64 `json:"PowerApparent_S_Phase_3"`
+			PowerApparentSSum    *float64 `json:"PowerApparent_S_Sum"`
+
+			PowerFactorPhase1 *float64 `json:"PowerFactor_Phase_1"`
+			PowerFactorPhase2 *float64 `json:"PowerFactor_Phase_2"`
+			PowerFactorPhase3 *float64 `json:"PowerFactor_Phase_3"`
+			PowerFactorSum    *float64 `json:"PowerFactor_Sum"`
+
+			PowerReactiveQPhase1 *float64 `json:"PowerReactive_Q_Phase_1"`
+			PowerReactiveQPhase2 *float64 `json:"PowerReactive_Q_Phase_2"`
+			PowerReactiveQPhase3 *float64 `json:"PowerReactive_Q_Phase_3"`
+			PowerReactiveQSum    *float64 `json:"PowerReactive_Q_Sum"`
+
+			PowerRealPPhase1 *float64 `json:"PowerReal_P_Phase_1"`
+			PowerRealPPhase2 *float64 `json:"PowerReal_P_Phase_2"`
+			PowerRealPPhase3 *float64 `json:"PowerReal_P_Phase_3"`
+			PowerRealPSum    *float64 `json:"PowerReal_P_Sum"`
+
+			VoltageACPhase1 *float64 `json:"Voltage_AC_Phase_1"`
+			VoltageACPhase2 *float64 `json:"Voltage_AC_Phase_2"`
+			VoltageACPhase3 *float64 `json:"Voltage_AC_Phase_3"`
+
+			// only published by three-phase meters
+			VoltageACPhaseToPhase12 *float64 `json:"Voltage_AC_PhaseToPhase_12"`
+			VoltageACPhaseToPhase23 *float64 `json:"Voltage_AC_PhaseToPhase_23"`
+			VoltageACPhaseToPhase31 *float64 `json:"Voltage_AC_PhaseToPhase_31"`
 		} `json:"Data"`
 	} `json:"Body"`
 	Head head `json:"head"`
 }
 
-// MeterRealtime returns realtime meter data.
+// meterLocation maps Meter_Location_Current to a location name.
+func meterLocation(code int) string {
+	switch {
+	case code == 0:
+		return "grid"
+	case code == 1:
+		return "load"
+	case code == 3:
+		return "generator"
+	case code >= 256 && code <= 511:
+		return "subload-" + strconv.Itoa(code-256)
+	default:
+		return "unknown"
+	}
+}
+
+// MeterRealtime returns realtime meter data. Readings the datalogger marks
+// as incomplete or outdated are skipped.
 func (c Client) MeterRealtime(ctx context.Context, deviceID string) (points []*write.Point, err error) {
 	var r meterRealtimeResponse
 
@@ -85,41 +124,39 @@ func (c Client) MeterRealtime(ctx context.Context, deviceID string) (points []*w
 	q.Set("Scope", "Device")
 	q.Set("DeviceId", deviceID)
 
-	u := url.URL{Scheme: "http", Host: c.host, Path: "/solar_api/v1/GetMeterRealtimeData.cgi", RawQuery: q.Encode()}
-
-	res, err := ctxhttp.Get(ctx, c.client, u.String())
+	err = c.get(ctx, "/solar_api/v1/GetMeterRealtimeData.cgi", q, &r)
 	if err != nil {
 		return points, err
 	}
 
-	defer func() {
-		if cErr := res.Body.Close(); cErr != nil {
-			err = cErr
-		}
-	}()
-
-	if res.StatusCode != http.StatusOK {
-		return points, fmt.Errorf("%w: %d", ErrStatusNotOk, res.StatusCode)
-	}
-
-	err = json.NewDecoder(res.Body).Decode(&r)
-	if err != nil {
-		return points, err
+	if v := r.Body.Data.Visible; v != nil && *v == 0 {
+		return points, nil
 	}
 
 	tags := map[string]string{
 		"device_id": deviceID,
+		"location":  meterLocation(r.Body.Data.MeterLocationCurrent),
 	}
 
-	values := map[string]interface{}{
+	addTags(tags, map[string]string{
+		"manufacturer": r.Body.Data.Details.Manufacturer,
+		"model":        r.Body.Data.Details.Model,
+		"serial":       r.Body.Data.Details.Serial,
+	})
+
+	values := map[string]interface{}{}
+
+	// channels the meter reports as null, or does not report at all, such as
+	// phase 2 and 3 on single-phase meters, are left out
+	addOptional(values, map[string]*float64{
 		"current_ac_phase_1":                      r.Body.Data.CurrentACPhase1,
 		"current_ac_sum":                          r.Body.Data.CurrentACSum,
-		"energy_real_watts_ac_minus_absolute":     r.Body.Data.EnergyRealWattsACMinusAbsolute,
-		"energy_real_watts_ac_plus_absolute":      r.Body.Data.EnergyRealWattsACPlusAbsolute,
-		"energy_real_watts_ac_phase_1_consumed":   r.Body.Data.EnergyRealWattsACPhase1Consumed,
-		"energy_real_watts_ac_phase_1_produced":   r.Body.Data.EnergyRealWattsACPhase1Produced,
-		"energy_real_watts_ac_sum_consumed":       r.Body.Data.EnergyRealWattsACSumConsumed,
-		"energy_real_watts_ac_sum_produced":       r.Body.Data.EnergyRealWattsACSumProduced,
+		"energy_real_wac_minus_absolute":          r.Body.Data.EnergyRealWattsACMinusAbsolute,
+		"energy_real_wac_plus_absolute":           r.Body.Data.EnergyRealWattsACPlusAbsolute,
+		"energy_real_wac_phase_1_consumed":        r.Body.Data.EnergyRealWattsACPhase1Consumed,
+		"energy_real_wac_phase_1_produced":        r.Body.Data.EnergyRealWattsACPhase1Produced,
+		"energy_real_wac_sum_consumed":            r.Body.Data.EnergyRealWattsACSumConsumed,
+		"energy_real_wac_sum_produced":            r.Body.Data.EnergyRealWattsACSumProduced,
 		"energy_reactive_var_ac_phase_1_consumed": r.Body.Data.EnergyReactiveVArACPhase1Consumed,
 		"energy_reactive_var_ac_phase_1_produced": r.Body.Data.EnergyReactiveVArACPhase1Produced,
 		"energy_reactive_var_ac_sum_consumed":     r.Body.Data.EnergyReactiveVArACSumConsumed,
@@ -134,29 +171,51 @@ func (c Client) MeterRealtime(ctx context.Context, deviceID string) (points []*w
 		"power_real_p_phase_1":                    r.Body.Data.PowerRealPPhase1,
 		"power_real_p_sum":                        r.Body.Data.PowerRealPSum,
 		"voltage_ac_phase_1":                      r.Body.Data.VoltageACPhase1,
+		"current_ac_phase_2":                      r.Body.Data.CurrentACPhase2,
+		"current_ac_phase_3":                      r.Body.Data.CurrentACPhase3,
+		"energy_real_wac_phase_2_consumed":        r.Body.Data.EnergyRealWattsACPhase2Consumed,
+		"energy_real_wac_phase_2_produced":        r.Body.Data.EnergyRealWattsACPhase2Produced,
+		"energy_real_wac_phase_3_consumed":        r.Body.Data.EnergyRealWattsACPhase3Consumed,
+		"energy_real_wac_phase_3_produced":        r.Body.Data.EnergyRealWattsACPhase3Produced,
+		"energy_reactive_var_ac_phase_2_consumed": r.Body.Data.EnergyReactiveVArACPhase2Consumed,
+		"energy_reactive_var_ac_phase_2_produced": r.Body.Data.EnergyReactiveVArACPhase2Produced,
+		"energy_reactive_var_ac_phase_3_consumed": r.Body.Data.EnergyReactiveVArACPhase3Consumed,
+		"energy_reactive_var_ac_phase_3_produced": r.Body.Data.EnergyReactiveVArACPhase3Produced,
+		"power_apparent_s_phase_2":                r.Body.Data.PowerApparentSPhase2,
+		"power_apparent_s_phase_3":                r.Body.Data.PowerApparentSPhase3,
+		"power_factor_phase_2":                    r.Body.Data.PowerFactorPhase2,
+		"power_factor_phase_3":                    r.Body.Data.PowerFactorPhase3,
+		"power_reactive_q_phase_2":                r.Body.Data.PowerReactiveQPhase2,
+		"power_reactive_q_phase_3":                r.Body.Data.PowerReactiveQPhase3,
+		"power_real_p_phase_2":                    r.Body.Data.PowerRealPPhase2,
+		"power_real_p_phase_3":                    r.Body.Data.PowerRealPPhase3,
+		"voltage_ac_phase_2":                      r.Body.Data.VoltageACPhase2,
+		"voltage_ac_phase_3":                      r.Body.Data.VoltageACPhase3,
+		"voltage_ac_phase_to_phase_12":            r.Body.Data.VoltageACPhaseToPhase12,
+		"voltage_ac_phase_to_phase_23":            r.Body.Data.VoltageACPhaseToPhase23,
+		"voltage_ac_phase_to_phase_31":            r.Body.Data.VoltageACPhaseToPhase31,
+	})
+
+	if len(values) == 0 {
+		return points, nil
+	}
+
+	if err = c.units.normalize(values); err != nil {
+		return points, err
 	}
 
 	return []*write.Point{
-		influxdb2.NewPoint("fronius_meter", tags, values, r.Head.Timestamp),
+		influxdb2.NewPoint("meter", tags, values, r.Head.Timestamp),
 	}, nil
 }
 
 // MeterArchive returns historical meter data.
-func (c Client) MeterArchive(ctx context.Context, deviceID string, startDate time.Time, endDate time.Time) (points []*write.Point, err error) {
-	q := defaultValues()
+func (c Client) MeterArchive(ctx context.Context, deviceID string, startDate time.Time, endDate time.Time, opts ArchiveOptions) (points []*write.Point, err error) {
+	q := url.Values{}
 
 	q.Set("Scope", "Device")
-	q.Set("SeriesType", "Detail")
-	q.Set("HumanReadable", "False")
 	q.Set("DeviceClass", "Meter")
 	q.Set("DeviceId", deviceID)
-	q.Set("StartDate", startDate.Format("2006-01-02"))
-	q.Set("EndDate", endDate.Format("2006-01-02"))
-
-	r, err := c.readArchive(ctx, q)
-	if err != nil {
-		return points, err
-	}
 
-	return generateArchivePoints(r, "meter_archive")
+	return c.archive(ctx, q, startDate, endDate, opts, "meter_archive")
 }
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
+)
+
+// mqttTimeout bounds connecting and each publish.
+const mqttTimeout = 10 * time.Second
+
+// topicTags are the tags that identify a point in the topic tree, in order.
+var topicTags = []string{"device_class", "device_id", "channel", "module", "led"}
+
+// haSensor is the Home Assistant metadata for a field.
+type haSensor struct {
+	unit        string
+	deviceClass string
+	stateClass  string
+}
+
+// mqttOutput publishes points as JSON to an MQTT broker, along with
+// Home Assistant MQTT discovery config for the fields it recognises.
+type mqttOutput struct {
+	client    mqtt.Client
+	topic     string
+	node      string
+	qos       byte
+	retain    bool
+	discovery string
+	units     unitSystem
+	naming    naming
+
+	// discovery topics already published by this process
+	announced map[string]bool
+}
+
+func newMQTTOutput(broker string, clientID string, username string, password string, topic string, node string, qos uint, retain bool, discovery string, units unitSystem, n naming) (*mqttOutput, error) {
+	opts := mqtt.NewClientOptions().
+		AddBroker(broker).
+		SetClientID(clientID).
+		SetUsername(username).
+		SetPassword(password).
+		SetConnectTimeout(mqttTimeout).
+		SetAutoReconnect(true)
+
+	client := mqtt.NewClient(opts)
+
+	token := client.Connect()
+	if !token.WaitTimeout(mqttTimeout) {
+		return nil, fmt.Errorf("mqtt connect to %s: %w", broker, context.DeadlineExceeded)
+	}
+
+	if err := token.Error(); err != nil {
+		return nil, err
+	}
+
+	return &mqttOutput{
+		client:    client,
+		topic:     strings.TrimSuffix(topic, "/"),
+		node:      invalidMetricChars.ReplaceAllString(node, "_"),
+		qos:       byte(qos),
+		retain:    retain,
+		discovery: strings.TrimSuffix(discovery, "/"),
+		units:     units,
+		naming:    n,
+		announced: make(map[string]bool),
+	}, nil
+}
+
+func (o *mqttOutput) write(ctx context.Context, points []*write.Point) error {
+	for _, p := range points {
+		tags := make(map[string]string)
+
+		for _, t := range p.TagList() {
+			tags[t.Key] = t.Value
+		}
+
+		// topics are below the topic prefix, so the measurement prefix is left out
+		path := []string{p.Name()}
+
+		for _, key := range topicTags {
+			if v, ok := tags[key]; ok {
+				path = append(path, v)
+			}
+		}
+
+		stateTopic := o.topic + "/" + strings.Join(path, "/")
+
+		// the point time is kept under a key no field uses, as storage
+		// points carry a numeric timestamp field of their own
+		payload := map[string]interface{}{
+			"time": p.Time().Format(time.RFC3339),
+		}
+
+		for _, f := range p.FieldList() {
+			field := o.naming.field(p.Name(), f.Key)
+
+			payload[field] = f.Value
+
+			if o.discovery != "" {
+				if err := o.announce(stateTopic, path, tags, field); err != nil {
+					return err
+				}
+			}
+		}
+
+		b, err := json.Marshal(payload)
+		if err != nil {
+			return err
+		}
+
+		if err = o.publish(stateTopic, b, o.retain); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// announce publishes the Home Assistant discovery config for a field once.
+func (o *mqttOutput) announce(stateTopic string, path []string, tags map[string]string, field string) error {
+	sensor, ok := haSensorFor(field)
+	if !ok {
+		return nil
+	}
+
+	if unit := o.units.unit(field); unit != "" {
+		sensor.unit = unit
+	}
+
+	objectID := invalidMetricChars.ReplaceAllString(strings.Join(append(path, field), "_"), "_")
+	configTopic := fmt.Sprintf("%s/sensor/%s/%s/config", o.discovery, o.node, objectID)
+
+	if o.announced[configTopic] {
+		return nil
+	}
+
+	device := map[string]interface{}{
+		"identifiers":  []string{o.node + "_" + invalidMetricChars.ReplaceAllString(strings.Join(path, "_"), "_")},
+		"name":         "Fronius " + strings.Join(path, " "),
+		"manufacturer": "Fronius",
+	}
+
+	if model, ok := tags["model"]; ok {
+		device["model"] = model
+	}
+
+	config := map[string]interface{}{
+		"name":           strings.Join(path, " ") + " " + strings.ReplaceAll(field, "_", " "),
+		"unique_id":      o.node + "_" + objectID,
+		"state_topic":    stateTopic,
+		"value_template": fmt.Sprintf("{{ value_json.%s }}", field),
+		"state_class":    sensor.stateClass,
+		"device":         device,
+	}
+
+	if sensor.unit != "" {
+		config["unit_of_measurement"] = sensor.unit
+	}
+
+	if sensor.deviceClass != "" {
+		config["device_class"] = sensor.deviceClass
+	}
+
+	b, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+
+	if err = o.publish(configTopic, b, true); err != nil {
+		return err
+	}
+
+	o.announced[configTopic] = true
+
+	return nil
+}
+
+func (o *mqttOutput) publish(topic string, payload []byte, retain bool) error {
+	token := o.client.Publish(topic, o.qos, retain, payload)
+	if !token.WaitTimeout(mqttTimeout) {
+		return fmt.Errorf("mqtt publish to %s: %w", topic, context.DeadlineExceeded)
+	}
+
+	return token.Error()
+}
+
+func (o *mqttOutput) close() error {
+	o.client.Disconnect(uint(time.Second / time.Millisecond))
+
+	return nil
+}
+
+// haSensorFor returns the Home Assistant metadata for a field name.
+func haSensorFor(field string) (haSensor, bool) {
+	switch {
+	case strings.HasPrefix(field, "energy_reactive"):
+		return haSensor{unit: "varh", stateClass: "total_increasing"}, true
+	case strings.HasPrefix(field, "energy_"):
+		return haSensor{unit: "Wh", deviceClass: "energy", stateClass: "total_increasing"}, true
+	case strings.HasPrefix(field, "power_factor"):
+		return haSensor{deviceClass: "power_factor", stateClass: "measurement"}, true
+	case strings.HasPrefix(field, "power_apparent"):
+		return haSensor{unit: "VA", deviceClass: "apparent_power", stateClass: "measurement"}, true
+	case strings.HasPrefix(field, "power_reactive"):
+		return haSensor{unit: "var", deviceClass: "reactive_power", stateClass: "measurement"}, true
+	case strings.HasPrefix(field, "power"):
+		return haSensor{unit: "W", deviceClass: "power", stateClass: "measurement"}, true
+	case strings.HasPrefix(field, "voltage_"):
+		return haSensor{unit: "V", deviceClass: "voltage", stateClass: "measurement"}, true
+	case strings.HasPrefix(field, "current_"):
+		return haSensor{unit: "A", deviceClass: "current", stateClass: "measurement"}, true
+	case strings.HasPrefix(field, "frequency"):
+		return haSensor{unit: "Hz", deviceClass: "frequency", stateClass: "measurement"}, true
+	case strings.HasPrefix(field, "temperature"):
+		return haSensor{unit: "°C", deviceClass: "temperature", stateClass: "measurement"}, true
+	case field == "state_of_charge":
+		return haSensor{unit: "%", deviceClass: "battery", stateClass: "measurement"}, true
+	case strings.HasPrefix(field, "relative_"):
+		return haSensor{unit: "%", stateClass: "measurement"}, true
+	default:
+		return haSensor{}, false
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
+)
+
+// defaultPrefix is the measurement prefix of earlier releases.
+const defaultPrefix = "fronius_"
+
+// namings are the supported naming schemes.
+var namings = map[string]bool{
+	"default": true,
+	"compat":  true,
+}
+
+// naming names the measurements and fields of collected points. Collectors
+// name measurements without a prefix. The default scheme prefixes every
+// measurement; the compat scheme reproduces the names of earlier releases,
+// which left archive measurements unprefixed and named meter energy fields
+// energy_real_watts_ac_*.
+type naming struct {
+	prefix string
+	compat bool
+}
+
+// parseNaming validates a naming scheme. The compat scheme only accepts
+// the default prefix, as any other would not reproduce earlier names.
+func parseNaming(scheme string, prefix string) (naming, error) {
+	if !namings[scheme] {
+		return naming{}, fmt.Errorf("%w: %s", ErrUnknownNaming, scheme)
+	}
+
+	if scheme == "compat" && prefix != defaultPrefix {
+		return naming{}, fmt.Errorf("%w: %s with %s naming", ErrUnsupportedPrefix, prefix, scheme)
+	}
+
+	return naming{prefix: prefix, compat: scheme == "compat"}, nil
+}
+
+// measurement returns the name a measurement is written as.
+func (n naming) measurement(name string) string {
+	if n.compat && strings.Contains(name, "_archive") {
+		return name
+	}
+
+	return n.prefix + name
+}
+
+// field returns the name a field of measurement is written as.
+func (n naming) field(measurement string, name string) string {
+	if n.compat && measurement == "meter" && strings.HasPrefix(name, "energy_real_wac_") {
+		return "energy_real_watts_ac_" + strings.TrimPrefix(name, "energy_real_wac_")
+	}
+
+	return name
+}
+
+// points returns the points with their measurements and fields named.
+func (n naming) points(points []*write.Point) []*write.Point {
+	named := make([]*write.Point, 0, len(points))
+
+	for _, p := range points {
+		tags := make(map[string]string)
+
+		for _, t := range p.TagList() {
+			tags[t.Key] = t.Value
+		}
+
+		values := make(map[string]interface{})
+
+		for _, f := range p.FieldList() {
+			values[n.field(p.Name(), f.Key)] = f.Value
+		}
+
+		named = append(named, influxdb2.NewPoint(n.measurement(p.Name()), tags, values, p.Time()))
+	}
+
+	return named
+}
+
+// namedOutput names points before writing them to an output.
+type namedOutput struct {
+	output
+	naming naming
+}
+
+func (o namedOutput) write(ctx context.Context, points []*write.Point) error {
+	return o.output.write(ctx, o.naming.points(points))
+}
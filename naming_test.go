@@ -0,0 +1,162 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
+)
+
+func TestParseNaming(t *testing.T) {
+	tests := []struct {
+		name   string
+		scheme string
+		prefix string
+		want   naming
+		err    error
+	}{
+		{name: "default", scheme: "default", prefix: defaultPrefix, want: naming{prefix: defaultPrefix}},
+		{name: "default with a prefix", scheme: "default", prefix: "solar_", want: naming{prefix: "solar_"}},
+		{name: "default without a prefix", scheme: "default", prefix: "", want: naming{}},
+		{name: "compat", scheme: "compat", prefix: defaultPrefix, want: naming{prefix: defaultPrefix, compat: true}},
+		{name: "compat with a prefix", scheme: "compat", prefix: "solar_", err: ErrUnsupportedPrefix},
+		{name: "unknown scheme", scheme: "legacy", prefix: defaultPrefix, err: ErrUnknownNaming},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n, err := parseNaming(tt.scheme, tt.prefix)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("got error %v, want %v", err, tt.err)
+			}
+
+			if n != tt.want {
+				t.Errorf("got %+v, want %+v", n, tt.want)
+			}
+		})
+	}
+}
+
+func TestNamingMeasurement(t *testing.T) {
+	def := naming{prefix: defaultPrefix}
+	custom := naming{prefix: "solar_"}
+	compat := naming{prefix: defaultPrefix, compat: true}
+
+	tests := []struct {
+		measurement string
+		def         string
+		custom      string
+		compat      string
+	}{
+		{"inverter", "fronius_inverter", "solar_inverter", "fronius_inverter"},
+		{"powerflow", "fronius_powerflow", "solar_powerflow", "fronius_powerflow"},
+		{"meter", "fronius_meter", "solar_meter", "fronius_meter"},
+		{"inverter_archive", "fronius_inverter_archive", "solar_inverter_archive", "inverter_archive"},
+		{"meter_archive_daily", "fronius_meter_archive_daily", "solar_meter_archive_daily", "meter_archive_daily"},
+		{"system_archive", "fronius_system_archive", "solar_system_archive", "system_archive"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.measurement, func(t *testing.T) {
+			if got := def.measurement(tt.measurement); got != tt.def {
+				t.Errorf("default: got %s, want %s", got, tt.def)
+			}
+
+			if got := custom.measurement(tt.measurement); got != tt.custom {
+				t.Errorf("custom prefix: got %s, want %s", got, tt.custom)
+			}
+
+			if got := compat.measurement(tt.measurement); got != tt.compat {
+				t.Errorf("compat: got %s, want %s", got, tt.compat)
+			}
+		})
+	}
+}
+
+func TestNamingField(t *testing.T) {
+	def := naming{prefix: defaultPrefix}
+	compat := naming{prefix: defaultPrefix, compat: true}
+
+	tests := []struct {
+		measurement string
+		field       string
+		def         string
+		compat      string
+	}{
+		{"meter", "energy_real_wac_sum_produced", "energy_real_wac_sum_produced", "energy_real_watts_ac_sum_produced"},
+		{"meter", "energy_real_wac_phase_1_consumed", "energy_real_wac_phase_1_consumed", "energy_real_watts_ac_phase_1_consumed"},
+		{"meter", "energy_reactive_var_ac_sum_produced", "energy_reactive_var_ac_sum_produced", "energy_reactive_var_ac_sum_produced"},
+		{"meter", "power_real_p_sum", "power_real_p_sum", "power_real_p_sum"},
+		{"meter_archive", "energy_real_wac_sum_produced", "energy_real_wac_sum_produced", "energy_real_wac_sum_produced"},
+		{"inverter", "energy_real_wac_sum_produced", "energy_real_wac_sum_produced", "energy_real_wac_sum_produced"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.measurement+"/"+tt.field, func(t *testing.T) {
+			if got := def.field(tt.measurement, tt.field); got != tt.def {
+				t.Errorf("default: got %s, want %s", got, tt.def)
+			}
+
+			if got := compat.field(tt.measurement, tt.field); got != tt.compat {
+				t.Errorf("compat: got %s, want %s", got, tt.compat)
+			}
+		})
+	}
+}
+
+func TestNamingPoints(t *testing.T) {
+	points := []*write.Point{
+		influxdb2.NewPoint("meter", map[string]string{"device_id": "0"}, map[string]interface{}{
+			"energy_real_wac_sum_produced": 100.0,
+			"power_real_p_sum":             -250.0,
+		}, date("2021-12-20 10:00")),
+		influxdb2.NewPoint("inverter_archive", map[string]string{"device_id": "1"}, map[string]interface{}{
+			"energy_real_wac_sum_produced": 10.0,
+		}, date("2021-12-20 10:05")),
+	}
+
+	tests := []struct {
+		name   string
+		naming naming
+		want   []string
+	}{
+		{
+			name:   "default",
+			naming: naming{prefix: defaultPrefix},
+			want: []string{
+				"fronius_meter,device_id=0 energy_real_wac_sum_produced=100,power_real_p_sum=-250 1639994400000000000\n",
+				"fronius_inverter_archive,device_id=1 energy_real_wac_sum_produced=10 1639994700000000000\n",
+			},
+		},
+		{
+			name:   "compat",
+			naming: naming{prefix: defaultPrefix, compat: true},
+			want: []string{
+				"fronius_meter,device_id=0 energy_real_watts_ac_sum_produced=100,power_real_p_sum=-250 1639994400000000000\n",
+				"inverter_archive,device_id=1 energy_real_wac_sum_produced=10 1639994700000000000\n",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			named := tt.naming.points(points)
+
+			if len(named) != len(tt.want) {
+				t.Fatalf("got %d points, want %d", len(named), len(tt.want))
+			}
+
+			for i, p := range named {
+				if got := write.PointToLineProtocol(p, precision); got != tt.want[i] {
+					t.Errorf("point %d: got %q, want %q", i, got, tt.want[i])
+				}
+			}
+		})
+	}
+
+	// the collected points are left as they were
+	if got := points[0].Name(); got != "meter" {
+		t.Errorf("input point renamed to %s", got)
+	}
+}
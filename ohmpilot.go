@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"net/url"
+
+	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
+)
+
+type ohmPilotRealtimeResponse struct {
+	Body struct {
+		Data map[string]struct {
+			Details struct {
+				Hardware     string `json:"Hardware"`
+				Manufacturer string `json:"Manufacturer"`
+				Model        string `json:"Model"`
+				Serial       string `json:"Serial"`
+				Software     string `json:"Software"`
+			} `json:"Details"`
+
+			// only present when CodeOfState is 3 (fault) or 4 (warning)
+			CodeOfError *int `json:"CodeOfError"`
+
+			// 0...up and running
+			// 1...keep minimum temperature
+			// 2...legionella protection
+			// 3...fault
+			// 4...warning
+			// 5...boost
+			CodeOfState int `json:"CodeOfState"`
+
+			// consumed energy in Wh
+			EnergyRealWACSumConsumed *float64 `json:"EnergyReal_WAC_Sum_Consumed"`
+
+			// actual power consumption in W
+			PowerRealPACSum *float64 `json:"PowerReal_PAC_Sum"`
+
+			// temperature from sensor in degrees Celsius
+			TemperatureChannel1 *float64 `json:"Temperature_Channel_1"`
+		} `json:"Data"`
+	} `json:"Body"`
+	Head head `json:"head"`
+}
+
+// ohmPilotStates maps CodeOfState to a state name.
+var ohmPilotStates = map[int]string{
+	0: "running",
+	1: "minimum_temperature",
+	2: "legionella_protection",
+	3: "fault",
+	4: "warning",
+	5: "boost",
+}
+
+// OhmPilotRealtime returns realtime data for every Ohmpilot device.
+func (c Client) OhmPilotRealtime(ctx context.Context) (points []*write.Point, err error) {
+	var r ohmPilotRealtimeResponse
+
+	q := url.Values{}
+
+	q.Set("Scope", "System")
+
+	err = c.get(ctx, "/solar_api/v1/GetOhmPilotRealtimeData.cgi", q, &r)
+	if err != nil {
+		return points, err
+	}
+
+	for deviceID, deviceData := range r.Body.Data {
+		tags := map[string]string{
+			"device_id": deviceID,
+		}
+
+		addTags(tags, map[string]string{
+			"model":  deviceData.Details.Model,
+			"serial": deviceData.Details.Serial,
+		})
+
+		values := map[string]interface{}{
+			"state_code": deviceData.CodeOfState,
+			"state_name": lookupName(ohmPilotStates, deviceData.CodeOfState),
+			"error_code": 0,
+		}
+
+		addOptional(values, map[string]*float64{
+			"energy_real_wac_sum_consumed": deviceData.EnergyRealWACSumConsumed,
+			"power_real_pac_sum":           deviceData.PowerRealPACSum,
+			"temperature_channel_1":        deviceData.TemperatureChannel1,
+		})
+
+		if deviceData.CodeOfError != nil {
+			values["error_code"] = *deviceData.CodeOfError
+		}
+
+		if err = c.units.normalize(values); err != nil {
+			return points, err
+		}
+
+		point := influxdb2.NewPoint("ohmpilot", tags, values, r.Head.Timestamp)
+
+		points = append(points, point)
+	}
+
+	return points, nil
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
+)
+
+// output writes points to a destination.
+type output interface {
+	write(ctx context.Context, points []*write.Point) error
+	close() error
+}
+
+// lineOutput writes points as line protocol.
+type lineOutput struct {
+	w io.Writer
+}
+
+func (o lineOutput) write(ctx context.Context, points []*write.Point) error {
+	for _, p := range points {
+		if _, err := fmt.Fprint(o.w, write.PointToLineProtocol(p, precision)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (o lineOutput) close() error {
+	return nil
+}
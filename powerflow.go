@@ -2,14 +2,10 @@ package main
 
 import (
 	"context"
-	"encoding/json"
-	"fmt"
-	"net/http"
-	"net/url"
+	"strconv"
 
 	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
 	"github.com/influxdata/influxdb-client-go/v2/api/write"
-	"golang.org/x/net/context/ctxhttp"
 )
 
 type powerFlowRealtimeResponse struct {
@@ -21,28 +17,38 @@ type powerFlowRealtimeResponse struct {
 				DeviceType int `json:"DT"`
 
 				// AC Energy [Wh] this day
-				EnergyDay float64 `json:"E_Day"`
+				EnergyDay *float64 `json:"E_Day"`
 
 				// AC Energy [Wh] this year
-				EnergyYear float64 `json:"E_Year"`
+				EnergyYear *float64 `json:"E_Year"`
 
 				// AC Energy [Wh] ever
-				EnergyTotal float64 `json:"E_Total"`
+				EnergyTotal *float64 `json:"E_Total"`
 
 				// current power in Watt
 				// +ve: produce/export
 				// -ve: consume/import
-				Power float64 `json:"P"`
+				Power *float64 `json:"P"`
+
+				// state of charge in % of an attached battery
+				StateOfCharge *float64 `json:"SOC"`
+
+				// component ID of an attached battery
+				ComponentID *int `json:"CID"`
+
+				// operating mode of an attached battery,
+				// e.g. "normal", "charge boost" or "suspended"
+				BatteryMode *string `json:"Battery_Mode"`
 			} `json:"Inverters"`
 			Site struct {
 				// AC Energy [Wh] this day
-				EnergyDay float64 `json:"E_Day"`
+				EnergyDay *float64 `json:"E_Day"`
 
 				// AC Energy [Wh] this year
-				EnergyYear float64 `json:"E_Year"`
+				EnergyYear *float64 `json:"E_Year"`
 
 				// AC Energy [Wh] ever
-				EnergyTotal float64 `json:"E_Total"`
+				EnergyTotal *float64 `json:"E_Total"`
 
 				// "load", "grid" or "unknown"
 				MeterLocation string `json:"Meter_Location"`
@@ -54,93 +60,224 @@ type powerFlowRealtimeResponse struct {
 
 				// +ve: discharge
 				// -ve: charge
-				PowerCumulative float64 `json:"P_Akku"`
+				PowerCumulative *float64 `json:"P_Akku"`
 
 				// +ve: from grid
 				// -ve: to grid
-				PowerGrid float64 `json:"P_Grid"`
+				PowerGrid *float64 `json:"P_Grid"`
 
 				// +ve: generator
 				// -ve: consumer
-				PowerLoad float64 `json:"P_Load"`
+				PowerLoad *float64 `json:"P_Load"`
 
 				// +ve: production
-				PowerConsumption float64 `json:"P_PV"`
+				PowerConsumption *float64 `json:"P_PV"`
 
 				// current relative autonomy in %
-				RelativeAutonomy float64 `json:"rel_Autonomy"`
+				RelativeAutonomy *float64 `json:"rel_Autonomy"`
 
 				// current relative self consumption in %
-				RelativeSelfConsumption float64 `json:"rel_SelfConsumption"`
+				RelativeSelfConsumption *float64 `json:"rel_SelfConsumption"`
+
+				// true while the site is supplied by the backup power circuit
+				BackupMode *bool `json:"BackupMode"`
+
+				// true while the battery is in standby
+				BatteryStandby *bool `json:"BatteryStandby"`
 			} `json:"Site"`
+			Smartloads struct {
+				Ohmpilots map[string]struct {
+					// current power consumption in Watt
+					PowerACTotal *float64 `json:"P_AC_Total"`
+
+					// "normal", "min-temperature", "legionella-protection",
+					// "fault", "warning" or "boost"
+					State string `json:"State"`
+
+					// temperature in degrees Celsius
+					Temperature *float64 `json:"Temperature"`
+				} `json:"Ohmpilots"`
+			} `json:"Smartloads"`
+			SecondaryMeters map[string]struct {
+				// current power in Watt
+				Power *float64 `json:"P"`
+
+				// location as in Meter_Location_Current of the meter data
+				MeterLocation *int `json:"MLoc"`
+
+				Label    string `json:"Label"`
+				Category string `json:"Category"`
+			} `json:"SecondaryMeters"`
 		} `json:"Data"`
 	} `json:"Body"`
 	Head head `json:"head"`
 }
 
-// PowerFlowRealtime returns realtime power flow data.
+// PowerFlowRealtime returns realtime power flow data. Inverters, the site,
+// secondary meters and Ohmpilots are written with their own device_class.
+// The schema is decoded up to Version 12; earlier versions, and firmware
+// without a Version, publish a subset of it, and the objects and fields a
+// version does not publish are left out. The version is written as a field
+// of the site.
 func (c Client) PowerFlowRealtime(ctx context.Context) (points []*write.Point, err error) {
 	var r powerFlowRealtimeResponse
 
-	u := url.URL{Scheme: "http", Host: c.host, Path: "/solar_api/v1/GetPowerFlowRealtimeData.fcgi"}
-
-	res, err := ctxhttp.Get(ctx, c.client, u.String())
+	err = c.get(ctx, "/solar_api/v1/GetPowerFlowRealtimeData.fcgi", nil, &r)
 	if err != nil {
 		return points, err
 	}
 
-	defer func() {
-		if cErr := res.Body.Close(); cErr != nil {
-			err = cErr
+	for deviceID, deviceData := range r.Body.Data.Inverters {
+		tags := map[string]string{
+			"device_id":    deviceID,
+			"device_class": "inverter",
+		}
+
+		values := map[string]interface{}{}
+
+		addOptional(values, map[string]*float64{
+			"energy_day":      deviceData.EnergyDay,
+			"energy_year":     deviceData.EnergyYear,
+			"energy_total":    deviceData.EnergyTotal,
+			"power":           deviceData.Power,
+			"state_of_charge": deviceData.StateOfCharge,
+		})
+
+		if deviceData.BatteryMode != nil {
+			values["battery_mode"] = *deviceData.BatteryMode
 		}
-	}()
 
-	if res.StatusCode != http.StatusOK {
-		return points, fmt.Errorf("%w: %d", ErrStatusNotOk, res.StatusCode)
+		if deviceData.ComponentID != nil {
+			tags["component_id"] = strconv.Itoa(*deviceData.ComponentID)
+		}
+
+		if len(values) == 0 {
+			continue
+		}
+
+		if err = c.units.normalize(values); err != nil {
+			return points, err
+		}
+
+		point := influxdb2.NewPoint("powerflow", tags, values, r.Head.Timestamp)
+
+		points = append(points, point)
 	}
 
-	err = json.NewDecoder(res.Body).Decode(&r)
-	if err != nil {
+	site := r.Body.Data.Site
+
+	tags := map[string]string{
+		"device_class": "site",
+	}
+
+	values := map[string]interface{}{}
+
+	// P_Akku, P_Grid and rel_Autonomy are null without a battery or meter
+	// or at night, and are left out rather than written as zero
+	addOptional(values, map[string]*float64{
+		"energy_day":                site.EnergyDay,
+		"energy_year":               site.EnergyYear,
+		"energy_total":              site.EnergyTotal,
+		"power_cumulative":          site.PowerCumulative,
+		"power_grid":                site.PowerGrid,
+		"power_load":                site.PowerLoad,
+		"power_consumption":         site.PowerConsumption,
+		"relative_autonomy":         site.RelativeAutonomy,
+		"relative_self_consumption": site.RelativeSelfConsumption,
+	})
+
+	if site.BackupMode != nil {
+		values["backup_mode"] = *site.BackupMode
+	}
+
+	if site.BatteryStandby != nil {
+		values["battery_standby"] = *site.BatteryStandby
+	}
+
+	// written as fields rather than tags, so the site stays one series
+	for key, value := range map[string]string{
+		"mode":           site.Mode,
+		"meter_location": site.MeterLocation,
+		"version":        r.Body.Data.Version,
+	} {
+		if value != "" {
+			values[key] = value
+		}
+	}
+
+	if err = c.units.normalize(values); err != nil {
 		return points, err
 	}
 
-	for deviceID, deviceData := range r.Body.Data.Inverters {
+	if len(values) > 0 {
+		point := influxdb2.NewPoint("powerflow", tags, values, r.Head.Timestamp)
+
+		points = append(points, point)
+	}
+
+	for deviceID, deviceData := range r.Body.Data.SecondaryMeters {
 		tags := map[string]string{
 			"device_id":    deviceID,
-			"device_class": "inverter",
+			"device_class": "secondary_meter",
+		}
+
+		addTags(tags, map[string]string{
+			"label":    deviceData.Label,
+			"category": deviceData.Category,
+		})
+
+		if deviceData.MeterLocation != nil {
+			tags["location"] = meterLocation(*deviceData.MeterLocation)
+		}
+
+		values := map[string]interface{}{}
+
+		addOptional(values, map[string]*float64{
+			"power": deviceData.Power,
+		})
+
+		if len(values) == 0 {
+			continue
 		}
 
-		values := map[string]interface{}{
-			"energy_day":   deviceData.EnergyDay,
-			"energy_year":  deviceData.EnergyYear,
-			"energy_total": deviceData.EnergyTotal,
-			"power":        deviceData.Power,
+		if err = c.units.normalize(values); err != nil {
+			return points, err
 		}
 
-		point := influxdb2.NewPoint("fronius_powerflow", tags, values, r.Head.Timestamp)
+		point := influxdb2.NewPoint("powerflow", tags, values, r.Head.Timestamp)
 
 		points = append(points, point)
 	}
 
-	tags := map[string]string{
-		"device_class": "site",
-	}
+	for deviceID, deviceData := range r.Body.Data.Smartloads.Ohmpilots {
+		tags := map[string]string{
+			"device_id":    deviceID,
+			"device_class": "ohmpilot",
+		}
 
-	values := map[string]interface{}{
-		"energy_day":                r.Body.Data.Site.EnergyDay,
-		"energy_year":               r.Body.Data.Site.EnergyYear,
-		"energy_total":              r.Body.Data.Site.EnergyTotal,
-		"power_cumulative":          r.Body.Data.Site.PowerCumulative,
-		"power_grid":                r.Body.Data.Site.PowerGrid,
-		"power_load":                r.Body.Data.Site.PowerLoad,
-		"power_consumption":         r.Body.Data.Site.PowerConsumption,
-		"relative_autonomy":         r.Body.Data.Site.RelativeAutonomy,
-		"relative_self_consumption": r.Body.Data.Site.RelativeSelfConsumption,
-	}
+		values := map[string]interface{}{}
+
+		addOptional(values, map[string]*float64{
+			"power_ac_total": deviceData.PowerACTotal,
+			"temperature":    deviceData.Temperature,
+		})
 
-	point := influxdb2.NewPoint("fronius_powerflow", tags, values, r.Head.Timestamp)
+		if deviceData.State != "" {
+			values["state_name"] = deviceData.State
+		}
+
+		if len(values) == 0 {
+			continue
+		}
+
+		if err = c.units.normalize(values); err != nil {
+			return points, err
+		}
+
+		point := influxdb2.NewPoint("powerflow", tags, values, r.Head.Timestamp)
 
-	points = append(points, point)
+		points = append(points, point)
+	}
 
 	return points, nil
 }
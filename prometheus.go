@@ -0,0 +1,256 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
+)
+
+// exporter serves realtime points in the Prometheus text exposition format.
+type exporter struct {
+	client   Client
+	s        selection
+	naming   naming
+	interval time.Duration
+
+	mu      sync.Mutex
+	metrics []byte
+}
+
+var invalidMetricChars = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+// sample is one exposed time series value.
+type sample struct {
+	labels string
+	value  float64
+}
+
+// family is a metric name with its type and samples.
+type family struct {
+	kind    string
+	samples []sample
+}
+
+// serveMetrics exposes /metrics on addr. With a zero interval the datalogger
+// is read on each scrape, otherwise in the background every interval.
+func serveMetrics(ctx context.Context, client Client, s selection, n naming, addr string, interval time.Duration) error {
+	e := &exporter{client: client, s: s, naming: n, interval: interval}
+
+	if interval > 0 {
+		e.refresh(ctx)
+
+		go func() {
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+					e.refresh(ctx)
+				}
+			}
+		}()
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", e)
+
+	server := &http.Server{Addr: addr, Handler: mux}
+
+	go func() {
+		<-ctx.Done()
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		_ = server.Shutdown(shutdownCtx)
+	}()
+
+	err := server.ListenAndServe()
+	if err == http.ErrServerClosed {
+		return nil
+	}
+
+	return err
+}
+
+func (e *exporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if e.interval == 0 {
+		e.refresh(r.Context())
+	}
+
+	e.mu.Lock()
+	metrics := e.metrics
+	e.mu.Unlock()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+	if _, err := w.Write(metrics); err != nil {
+		log.Print(err)
+	}
+}
+
+// refresh reads the datalogger and renders the exposition.
+func (e *exporter) refresh(ctx context.Context) {
+	start := time.Now()
+
+	points, err := collectRealtime(ctx, e.client, e.s)
+	if err != nil {
+		log.Print(err)
+	}
+
+	up := 1.0
+	if err != nil {
+		up = 0
+	}
+
+	families := toFamilies(points, e.naming)
+
+	families[e.naming.prefix+"up"] = &family{kind: "gauge", samples: []sample{{value: up}}}
+	families[e.naming.prefix+"scrape_duration_seconds"] = &family{kind: "gauge", samples: []sample{{value: time.Since(start).Seconds()}}}
+
+	metrics := renderFamilies(families)
+
+	e.mu.Lock()
+	e.metrics = metrics
+	e.mu.Unlock()
+}
+
+// toFamilies maps point fields to metric families. Cumulative energy fields
+// become counters, other numeric fields become gauges. Metric names follow
+// the naming scheme n.
+func toFamilies(points []*write.Point, n naming) map[string]*family {
+	families := make(map[string]*family)
+
+	for _, p := range points {
+		labels := map[string]string{
+			"device_class": p.Name(),
+		}
+
+		for _, t := range p.TagList() {
+			labels[t.Key] = t.Value
+		}
+
+		rendered := renderLabels(labels)
+
+		for _, f := range p.FieldList() {
+			value, ok := toFloat(f.Value)
+			if !ok {
+				continue
+			}
+
+			name, kind := metricName(n.measurement(p.Name()), n.field(p.Name(), f.Key))
+
+			fam, ok := families[name]
+			if !ok {
+				fam = &family{kind: kind}
+				families[name] = fam
+			}
+
+			fam.samples = append(fam.samples, sample{labels: rendered, value: value})
+		}
+	}
+
+	return families
+}
+
+// metricName returns the metric name and type for a field of measurement.
+func metricName(measurement string, field string) (name string, kind string) {
+	name = invalidMetricChars.ReplaceAllString(measurement+"_"+field, "_")
+
+	if isCounter(field) {
+		return strings.Replace(name, "_total", "", 1) + "_total", "counter"
+	}
+
+	return name, "gauge"
+}
+
+// isCounter reports whether field is a cumulative energy total.
+func isCounter(field string) bool {
+	if !strings.HasPrefix(field, "energy_") {
+		return false
+	}
+
+	return !strings.Contains(field, "_day") && !strings.Contains(field, "_year")
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return v, true
+	case int64:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case bool:
+		if v {
+			return 1, true
+		}
+
+		return 0, true
+	default:
+		return 0, false
+	}
+}
+
+func renderLabels(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+
+	for k := range labels {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys))
+
+	for _, k := range keys {
+		v := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(labels[k])
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, invalidMetricChars.ReplaceAllString(k, "_"), v))
+	}
+
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func renderFamilies(families map[string]*family) []byte {
+	names := make([]string, 0, len(families))
+
+	for name := range families {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	var b bytes.Buffer
+
+	for _, name := range names {
+		fam := families[name]
+
+		fmt.Fprintf(&b, "# TYPE %s %s\n", name, fam.kind)
+
+		sort.Slice(fam.samples, func(i, j int) bool {
+			return fam.samples[i].labels < fam.samples[j].labels
+		})
+
+		for _, s := range fam.samples {
+			if s.labels == "" {
+				fmt.Fprintf(&b, "%s %g\n", name, s.value)
+			} else {
+				fmt.Fprintf(&b, "%s%s %g\n", name, s.labels, s.value)
+			}
+		}
+	}
+
+	return b.Bytes()
+}
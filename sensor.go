@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"net/url"
+
+	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
+)
+
+type sensorRealtimeResponse struct {
+	Body struct {
+		// keyed by channel number
+		Data map[string]struct {
+			Unit  string   `json:"Unit"`
+			Value *float64 `json:"Value"`
+		} `json:"Data"`
+	} `json:"Body"`
+	Head head `json:"head"`
+}
+
+type sensorMinMax struct {
+	Max *float64 `json:"Max"`
+	Min *float64 `json:"Min"`
+}
+
+type sensorMinMaxResponse struct {
+	Body struct {
+		// keyed by channel number
+		Data map[string]struct {
+			Unit  string       `json:"Unit"`
+			Day   sensorMinMax `json:"Day"`
+			Month sensorMinMax `json:"Month"`
+			Year  sensorMinMax `json:"Year"`
+			Total sensorMinMax `json:"Total"`
+		} `json:"Data"`
+	} `json:"Body"`
+	Head head `json:"head"`
+}
+
+// SensorRealtime returns realtime sensor card data.
+func (c Client) SensorRealtime(ctx context.Context, deviceID string) (points []*write.Point, err error) {
+	var r sensorRealtimeResponse
+
+	q := url.Values{}
+
+	q.Set("Scope", "Device")
+	q.Set("DeviceId", deviceID)
+	q.Set("DataCollection", "NowSensorData")
+
+	err = c.get(ctx, "/solar_api/v1/GetSensorRealtimeData.cgi", q, &r)
+	if err != nil {
+		return points, err
+	}
+
+	for channel, channelData := range r.Body.Data {
+		if channelData.Value == nil {
+			continue
+		}
+
+		tags := map[string]string{
+			"device_id": deviceID,
+			"channel":   channel,
+		}
+
+		addTags(tags, map[string]string{
+			"unit": channelData.Unit,
+		})
+
+		values := map[string]interface{}{
+			"value": *channelData.Value,
+		}
+
+		point := influxdb2.NewPoint("sensor", tags, values, r.Head.Timestamp)
+
+		points = append(points, point)
+	}
+
+	return points, nil
+}
+
+// SensorMinMax returns minimum and maximum sensor card data.
+func (c Client) SensorMinMax(ctx context.Context, deviceID string) (points []*write.Point, err error) {
+	var r sensorMinMaxResponse
+
+	q := url.Values{}
+
+	q.Set("Scope", "Device")
+	q.Set("DeviceId", deviceID)
+	q.Set("DataCollection", "MinMaxSensorData")
+
+	err = c.get(ctx, "/solar_api/v1/GetSensorRealtimeData.cgi", q, &r)
+	if err != nil {
+		return points, err
+	}
+
+	for channel, channelData := range r.Body.Data {
+		tags := map[string]string{
+			"device_id": deviceID,
+			"channel":   channel,
+		}
+
+		addTags(tags, map[string]string{
+			"unit": channelData.Unit,
+		})
+
+		values := map[string]interface{}{}
+
+		addOptional(values, map[string]*float64{
+			"day_max":   channelData.Day.Max,
+			"day_min":   channelData.Day.Min,
+			"month_max": channelData.Month.Max,
+			"month_min": channelData.Month.Min,
+			"year_max":  channelData.Year.Max,
+			"year_min":  channelData.Year.Min,
+			"total_max": channelData.Total.Max,
+			"total_min": channelData.Total.Min,
+		})
+
+		if len(values) == 0 {
+			continue
+		}
+
+		point := influxdb2.NewPoint("sensor_minmax", tags, values, r.Head.Timestamp)
+
+		points = append(points, point)
+	}
+
+	return points, nil
+}
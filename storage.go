@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+
+	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
+)
+
+type storageData struct {
+	Details struct {
+		Manufacturer string `json:"Manufacturer"`
+		Model        string `json:"Model"`
+		Serial       string `json:"Serial"`
+	} `json:"Details"`
+
+	// 1...enabled, 0...disabled
+	Enable int `json:"Enable"`
+
+	TimeStamp int `json:"TimeStamp"`
+
+	// maximum capacity in Ah as reported by the battery
+	CapacityMaximum *float64 `json:"Capacity_Maximum"`
+
+	// designed capacity in Ah
+	DesignedCapacity *float64 `json:"DesignedCapacity"`
+
+	// +ve: discharge
+	// -ve: charge
+	CurrentDC *float64 `json:"Current_DC"`
+
+	VoltageDC *float64 `json:"Voltage_DC"`
+
+	// state of charge in %
+	StateOfChargeRelative *float64 `json:"StateOfCharge_Relative"`
+
+	TemperatureCell *float64 `json:"Temperature_Cell"`
+
+	// not published by all batteries
+	CycleCountBatteryCell  *float64 `json:"CycleCount_BatteryCell"`
+	StatusBatteryCell      *float64 `json:"Status_BatteryCell"`
+	TemperatureCellMaximum *float64 `json:"Temperature_Cell_Maximum"`
+	TemperatureCellMinimum *float64 `json:"Temperature_Cell_Minimum"`
+	VoltageDCMaximumCell   *float64 `json:"Voltage_DC_Maximum_Cell"`
+	VoltageDCMinimumCell   *float64 `json:"Voltage_DC_Minimum_Cell"`
+}
+
+type storageRealtimeResponse struct {
+	Body struct {
+		Data map[string]struct {
+			Controller storageData   `json:"Controller"`
+			Modules    []storageData `json:"Modules"`
+		} `json:"Data"`
+	} `json:"Body"`
+	Head head `json:"head"`
+}
+
+// StorageRealtime returns realtime storage data for every storage device.
+func (c Client) StorageRealtime(ctx context.Context) (points []*write.Point, err error) {
+	var r storageRealtimeResponse
+
+	q := url.Values{}
+
+	q.Set("Scope", "System")
+
+	err = c.get(ctx, "/solar_api/v1/GetStorageRealtimeData.cgi", q, &r)
+	if err != nil {
+		return points, err
+	}
+
+	for deviceID, deviceData := range r.Body.Data {
+		tags := map[string]string{
+			"device_id":    deviceID,
+			"device_class": "controller",
+		}
+
+		values, err := storageValues(deviceData.Controller, c.units)
+		if err != nil {
+			return points, err
+		}
+
+		point := influxdb2.NewPoint("storage", storageTags(tags, deviceData.Controller), values, r.Head.Timestamp)
+
+		points = append(points, point)
+
+		for i, module := range deviceData.Modules {
+			tags := map[string]string{
+				"device_id":    deviceID,
+				"device_class": "module",
+				"module":       strconv.Itoa(i),
+			}
+
+			values, err := storageValues(module, c.units)
+			if err != nil {
+				return points, err
+			}
+
+			point := influxdb2.NewPoint("storage", storageTags(tags, module), values, r.Head.Timestamp)
+
+			points = append(points, point)
+		}
+	}
+
+	return points, nil
+}
+
+func storageTags(tags map[string]string, d storageData) map[string]string {
+	addTags(tags, map[string]string{
+		"manufacturer": d.Details.Manufacturer,
+		"model":        d.Details.Model,
+		"serial":       d.Details.Serial,
+	})
+
+	return tags
+}
+
+func storageValues(d storageData, units unitSystem) (map[string]interface{}, error) {
+	values := map[string]interface{}{
+		"enable":    d.Enable,
+		"timestamp": d.TimeStamp,
+	}
+
+	addOptional(values, map[string]*float64{
+		"capacity_maximum":         d.CapacityMaximum,
+		"designed_capacity":        d.DesignedCapacity,
+		"current_dc":               d.CurrentDC,
+		"voltage_dc":               d.VoltageDC,
+		"state_of_charge":          d.StateOfChargeRelative,
+		"temperature_cell":         d.TemperatureCell,
+		"cycle_count":              d.CycleCountBatteryCell,
+		"status_battery_cell":      d.StatusBatteryCell,
+		"temperature_cell_maximum": d.TemperatureCellMaximum,
+		"temperature_cell_minimum": d.TemperatureCellMinimum,
+		"voltage_dc_maximum_cell":  d.VoltageDCMaximumCell,
+		"voltage_dc_minimum_cell":  d.VoltageDCMinimumCell,
+	})
+
+	return values, units.normalize(values)
+}
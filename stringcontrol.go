@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"strings"
+
+	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
+)
+
+type stringRealtimeResponse struct {
+	Body struct {
+		// keyed by string channel, then by quantity
+		Data map[string]map[string]json.RawMessage `json:"Data"`
+	} `json:"Body"`
+	Head head `json:"head"`
+}
+
+// stringCollections maps each String Control data collection to its
+// measurement, and quantities whose field name differs from their own.
+var stringCollections = []struct {
+	collection  string
+	measurement string
+	fields      map[string]string
+}{
+	{"NowStringControlData", "string", nil},
+	{"LastErrorStringControlData", "string_last_error", nil},
+	// the daily current sum is a charge in Ah rather than a current
+	{"CurrentSumStringControlData", "string_current_sum", map[string]string{"current": "charge"}},
+}
+
+// StringRealtime returns realtime per-string String Control data.
+func (c Client) StringRealtime(ctx context.Context, deviceID string) (points []*write.Point, err error) {
+	for _, sc := range stringCollections {
+		var r stringRealtimeResponse
+
+		q := url.Values{}
+
+		q.Set("Scope", "Device")
+		q.Set("DeviceId", deviceID)
+		q.Set("DataCollection", sc.collection)
+
+		if sc.collection == "CurrentSumStringControlData" {
+			q.Set("TimePeriod", "Day")
+		}
+
+		err = c.get(ctx, "/solar_api/v1/GetStringRealtimeData.cgi", q, &r)
+		if err != nil {
+			return points, err
+		}
+
+		for channel, channelData := range r.Body.Data {
+			tags := map[string]string{
+				"device_id": deviceID,
+				"channel":   channel,
+			}
+
+			values := map[string]interface{}{}
+
+			for quantity, raw := range channelData {
+				var v struct {
+					Unit  string   `json:"Unit"`
+					Value *float64 `json:"Value"`
+				}
+
+				// skip entries that are not a unit and value pair
+				if json.Unmarshal(raw, &v) != nil || v.Value == nil {
+					continue
+				}
+
+				key := strings.ToLower(quantity)
+				if field, ok := sc.fields[key]; ok {
+					key = field
+				}
+
+				if values[key], err = c.units.convert(key, *v.Value, v.Unit); err != nil {
+					return points, err
+				}
+			}
+
+			if len(values) == 0 {
+				continue
+			}
+
+			point := influxdb2.NewPoint(sc.measurement, tags, values, r.Head.Timestamp)
+
+			points = append(points, point)
+		}
+	}
+
+	return points, nil
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// defaultUnits are the canonical units values are written in.
+const defaultUnits = "W,Wh,V,A,Ah,Hz,VA,var,varh"
+
+// unitScale is the quantity a unit measures and its factor to the base unit.
+type unitScale struct {
+	quantity string
+	factor   float64
+}
+
+// unitScales are the known units of the quantities with a canonical unit.
+var unitScales = map[string]unitScale{
+	"W":     {"power", 1},
+	"kW":    {"power", 1e3},
+	"MW":    {"power", 1e6},
+	"Wh":    {"energy", 1},
+	"kWh":   {"energy", 1e3},
+	"MWh":   {"energy", 1e6},
+	"V":     {"voltage", 1},
+	"mV":    {"voltage", 1e-3},
+	"kV":    {"voltage", 1e3},
+	"A":     {"current", 1},
+	"mA":    {"current", 1e-3},
+	"Ah":    {"charge", 1},
+	"mAh":   {"charge", 1e-3},
+	"Hz":    {"frequency", 1},
+	"VA":    {"apparent_power", 1},
+	"kVA":   {"apparent_power", 1e3},
+	"var":   {"reactive_power", 1},
+	"VAr":   {"reactive_power", 1},
+	"kvar":  {"reactive_power", 1e3},
+	"kVAr":  {"reactive_power", 1e3},
+	"varh":  {"reactive_energy", 1},
+	"VArh":  {"reactive_energy", 1},
+	"kvarh": {"reactive_energy", 1e3},
+	"kVArh": {"reactive_energy", 1e3},
+}
+
+// fieldUnits are the base units of fields by name prefix, checked in order.
+// Fields without a matching prefix, such as temperatures or percentages,
+// are written as reported.
+var fieldUnits = []struct {
+	prefix string
+	unit   string
+}{
+	{"energy_reactive", "varh"},
+	{"energy", "Wh"},
+	{"power_factor", ""},
+	{"power_apparent", "VA"},
+	{"power_reactive", "var"},
+	{"power", "W"},
+	{"voltage", "V"},
+	{"current", "A"},
+	{"charge", "Ah"},
+	{"frequency", "Hz"},
+}
+
+// fieldUnit returns the base unit of a field, or "" for fields that are not
+// converted.
+func fieldUnit(field string) string {
+	for _, f := range fieldUnits {
+		if strings.HasPrefix(field, f.prefix) {
+			return f.unit
+		}
+	}
+
+	return ""
+}
+
+// unitSystem maps quantities to the unit they are written in. Quantities
+// that are not present are written in their base unit.
+type unitSystem map[string]string
+
+// parseUnits parses a comma separated list of canonical units.
+func parseUnits(list string) (units unitSystem, err error) {
+	units = make(unitSystem)
+
+	for _, unit := range strings.Split(list, ",") {
+		unit = strings.TrimSpace(unit)
+
+		if unit == "" {
+			continue
+		}
+
+		scale, ok := unitScales[unit]
+		if !ok {
+			return units, fmt.Errorf("%w: %s", ErrUnknownUnit, unit)
+		}
+
+		units[scale.quantity] = unit
+	}
+
+	return units, nil
+}
+
+// convert returns the value of field, reported in unit, in the canonical
+// unit of its quantity. An empty unit is taken to be the base unit of the
+// field, as documented for endpoints that do not report units. A unit that
+// is not known, or that does not measure the quantity of the field, is an
+// error rather than a value on a different scale.
+func (u unitSystem) convert(field string, value float64, unit string) (float64, error) {
+	base := fieldUnit(field)
+	if base == "" {
+		return value, nil
+	}
+
+	if unit == "" {
+		unit = base
+	}
+
+	scale, ok := unitScales[unit]
+	if !ok {
+		return value, fmt.Errorf("%w: %s in %s", ErrUnknownUnit, unit, field)
+	}
+
+	quantity := unitScales[base].quantity
+
+	if scale.quantity != quantity {
+		return value, fmt.Errorf("%w: %s in %s", ErrUnexpectedUnit, unit, field)
+	}
+
+	canonical, ok := u[quantity]
+	if !ok {
+		canonical = base
+	}
+
+	return value * scale.factor / unitScales[canonical].factor, nil
+}
+
+// unit returns the unit a field is written in, or "" for fields that are
+// not converted.
+func (u unitSystem) unit(field string) string {
+	base := fieldUnit(field)
+	if base == "" {
+		return ""
+	}
+
+	if canonical, ok := u[unitScales[base].quantity]; ok {
+		return canonical
+	}
+
+	return base
+}
+
+// normalize converts the float values of fields reported without units.
+func (u unitSystem) normalize(values map[string]interface{}) (err error) {
+	for key, value := range values {
+		v, ok := value.(float64)
+		if !ok {
+			continue
+		}
+
+		if values[key], err = u.convert(key, v, ""); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// unitValue is a value with the unit it is reported in.
+type unitValue struct {
+	Unit  string   `json:"Unit"`
+	Value *float64 `json:"Value"`
+}
+
+// addUnits converts the non-nil values from their reported units and copies
+// them into values.
+func (u unitSystem) addUnits(values map[string]interface{}, measured map[string]unitValue) (err error) {
+	for key, m := range measured {
+		if m.Value == nil {
+			continue
+		}
+
+		if values[key], err = u.convert(key, *m.Value, m.Unit); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseUnits(t *testing.T) {
+	tests := []struct {
+		name string
+		list string
+		want unitSystem
+		err  error
+	}{
+		{
+			name: "empty",
+			list: "",
+			want: unitSystem{},
+		},
+		{
+			name: "defaults",
+			list: defaultUnits,
+			want: unitSystem{
+				"power":           "W",
+				"energy":          "Wh",
+				"voltage":         "V",
+				"current":         "A",
+				"charge":          "Ah",
+				"frequency":       "Hz",
+				"apparent_power":  "VA",
+				"reactive_power":  "var",
+				"reactive_energy": "varh",
+			},
+		},
+		{
+			name: "spaces and empty entries",
+			list: " kW , kWh,,mAh",
+			want: unitSystem{"power": "kW", "energy": "kWh", "charge": "mAh"},
+		},
+		{
+			name: "later unit of a quantity wins",
+			list: "W,kW",
+			want: unitSystem{"power": "kW"},
+		},
+		{
+			name: "unknown unit",
+			list: "kW,furlong",
+			err:  ErrUnknownUnit,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			units, err := parseUnits(tt.list)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("got error %v, want %v", err, tt.err)
+			}
+
+			if tt.err != nil {
+				return
+			}
+
+			if len(units) != len(tt.want) {
+				t.Fatalf("got %v, want %v", units, tt.want)
+			}
+
+			for quantity, unit := range tt.want {
+				if units[quantity] != unit {
+					t.Errorf("%s: got %q, want %q", quantity, units[quantity], unit)
+				}
+			}
+		})
+	}
+}
+
+func TestConvert(t *testing.T) {
+	tests := []struct {
+		name  string
+		units string
+		field string
+		value float64
+		unit  string
+		want  float64
+		err   error
+	}{
+		{name: "base unit", field: "power", value: 1500, unit: "W", want: 1500},
+		{name: "empty unit is the base unit", field: "energy_day", value: 1500, unit: "", want: 1500},
+		{name: "to base unit", field: "energy_total", value: 1.5, unit: "MWh", want: 1500000},
+		{name: "to canonical unit", units: "kW", field: "power_ac", value: 1500, unit: "W", want: 1.5},
+		{name: "between scaled units", units: "kWh", field: "energy_year", value: 2, unit: "MWh", want: 2000},
+		{name: "reactive power", units: "kvar", field: "power_reactive_sum", value: 500, unit: "VAr", want: 0.5},
+		{name: "reactive energy before energy", field: "energy_reactive_var_ac_sum", value: 2, unit: "kVArh", want: 2000},
+		{name: "charge", units: "mAh", field: "charge", value: 12.5, unit: "Ah", want: 12500},
+		{name: "field without a unit", field: "temperature", value: 21, unit: "°C", want: 21},
+		{name: "power factor is not power", field: "power_factor", value: 0.9, unit: "", want: 0.9},
+		{name: "unknown unit", field: "power", value: 1, unit: "hp", err: ErrUnknownUnit},
+		{name: "wrong quantity", field: "current", value: 12.5, unit: "Ah", err: ErrUnexpectedUnit},
+		{name: "energy in power", field: "energy_day", value: 1, unit: "kW", err: ErrUnexpectedUnit},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			units, err := parseUnits(tt.units)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := units.convert(tt.field, tt.value, tt.unit)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("got error %v, want %v", err, tt.err)
+			}
+
+			if tt.err == nil && got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name   string
+		units  string
+		values map[string]interface{}
+		want   map[string]interface{}
+	}{
+		{
+			name:   "base units",
+			values: map[string]interface{}{"power": 1500.0, "energy_day": 3000.0},
+			want:   map[string]interface{}{"power": 1500.0, "energy_day": 3000.0},
+		},
+		{
+			name:   "canonical units",
+			units:  "kW,kWh",
+			values: map[string]interface{}{"power": 1500.0, "energy_day": 3000.0, "relative_autonomy": 80.0},
+			want:   map[string]interface{}{"power": 1.5, "energy_day": 3.0, "relative_autonomy": 80.0},
+		},
+		{
+			name:   "values that are not floats",
+			units:  "kW",
+			values: map[string]interface{}{"power_state": "on", "power_mode": 2, "backup_mode": true},
+			want:   map[string]interface{}{"power_state": "on", "power_mode": 2, "backup_mode": true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			units, err := parseUnits(tt.units)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err = units.normalize(tt.values); err != nil {
+				t.Fatal(err)
+			}
+
+			for key, want := range tt.want {
+				if tt.values[key] != want {
+					t.Errorf("%s: got %v, want %v", key, tt.values[key], want)
+				}
+			}
+		})
+	}
+}